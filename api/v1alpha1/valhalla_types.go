@@ -17,10 +17,19 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/itayankri/valhalla-operator/internal/status"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -29,6 +38,52 @@ import (
 
 const OperatorPausedAnnotation = "valhalla.itayankri/operator.paused"
 
+// Pause annotations of individual components. Unlike the operator.paused annotation they
+// keep the rest of the instance reconciled, e.g. the workers keep autoscaling.
+const (
+	// MapBuildsPausedAnnotation stops starting map builds, including scheduled and requested ones.
+	MapBuildsPausedAnnotation = "valhalla.itayankri/map-builds.paused"
+	// PredictedTrafficPausedAnnotation suspends the predicted traffic CronJob.
+	PredictedTrafficPausedAnnotation = "valhalla.itayankri/predicted-traffic.paused"
+	// WorkersPausedAnnotation pauses the rollouts of the worker Deployment.
+	WorkersPausedAnnotation = "valhalla.itayankri/workers.paused"
+)
+
+// MapRefreshAnnotation holds the time the most recent map refresh was started, in RFC 3339 format.
+// It is set by the operator and is part of the map version, so that the served version survives
+// restoring the resource without its status, e.g. from a backup.
+const MapRefreshAnnotation = "valhalla.itayankri/map-refresh"
+
+// MapRefreshEnabledAnnotation holds the time spec.mapRefresh was enabled, in RFC 3339 format.
+// It is set by the operator and is not part of the map version. Scheduled map refreshes are counted
+// from it until the first one starts, so enabling them does not rebuild an existing map right away.
+const MapRefreshEnabledAnnotation = "valhalla.itayankri/map-refresh-enabled"
+
+// ActionAnnotationPrefix prefixes the annotations requesting actions from the operator, e.g.
+// valhalla.itayankri/action.rebuild-map. Every value of an action annotation is handled once,
+// so an action is requested again by changing the value, e.g. to the current time.
+const ActionAnnotationPrefix = "valhalla.itayankri/action."
+
+const (
+	// RebuildMapAction builds the map again from the current PBF data.
+	RebuildMapAction = "rebuild-map"
+	// RetryMapBuildAction re-creates a failed builder Job.
+	RetryMapBuildAction = "retry-map-build"
+	// RestartWorkersAction rolls out the worker pods again.
+	RestartWorkersAction = "restart-workers"
+	// RefreshPredictedTrafficAction runs the predicted traffic Job immediately.
+	RefreshPredictedTrafficAction = "refresh-predicted-traffic"
+)
+
+const defaultMinReplicas = int32(1)
+const defaultThreadsPerPod = int32(2)
+const defaultStorage = "10Gi"
+const defaultTargetCPUUtilizationPercentage = int32(85)
+const defaultPath = "/"
+const defaultMaxRetries = int32(3)
+const defaultRetryBackoff = 5 * time.Minute
+const defaultMaxRetryBackoff = time.Hour
+
 // Phase is the current phase of the deployment
 type Phase string
 
@@ -62,16 +117,33 @@ const (
 type ValhallaSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
-	PBFURL           string                       `json:"pbfUrl,omitempty"`
-	Image            *string                      `json:"image,omitempty"`
-	Persistence      PersistenceSpec              `json:"persistence,omitempty"`
-	Service          *ServiceSpec                 `json:"service,omitempty"`
+	PBFURL           string                        `json:"pbfUrl,omitempty"`
+	PBFChecksum      *ChecksumSpec                 `json:"pbfChecksum,omitempty"`
+	PBFSources       []PBFSource                   `json:"pbfSources,omitempty"`
+	Image            *string                       `json:"image,omitempty"`
+	ImagePullPolicy  corev1.PullPolicy             `json:"imagePullPolicy,omitempty"`
+	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+	Persistence      PersistenceSpec               `json:"persistence,omitempty"`
+	Service          *ServiceSpec                  `json:"service,omitempty"`
+	Ingress          *IngressSpec                  `json:"ingress,omitempty"`
+	HTTPRoute        *HTTPRouteSpec                `json:"httpRoute,omitempty"`
+	NetworkPolicy    *NetworkPolicySpec            `json:"networkPolicy,omitempty"`
+	// Replicas runs a fixed number of workers without a HorizontalPodAutoscaler.
+	// minReplicas, maxReplicas and autoscaling are ignored when it is set.
+	// +kubebuilder:validation:Minimum=0
+	Replicas         *int32                       `json:"replicas,omitempty"`
 	MinReplicas      *int32                       `json:"minReplicas,omitempty"`
 	MaxReplicas      *int32                       `json:"maxReplicas,omitempty"`
 	MinAvailable     *int32                       `json:"minAvailable,omitempty"`
 	ThreadsPerPod    *int32                       `json:"threadsPerPod,omitempty"`
 	Resources        *corev1.ResourceRequirements `json:"resources,omitempty"`
 	PredictedTraffic *PredictedTrafficSpec        `json:"predictedTraffic,omitempty"`
+	MapRefresh       *MapRefreshSpec              `json:"mapRefresh,omitempty"`
+	Builder          *BuilderSpec                 `json:"builder,omitempty"`
+	Config           *ConfigSpec                  `json:"config,omitempty"`
+	Workers          *WorkersSpec                 `json:"workers,omitempty"`
+	Autoscaling      *AutoscalingSpec             `json:"autoscaling,omitempty"`
+	ScalingSchedule  []ScalingWindowSpec          `json:"scalingSchedule,omitempty"`
 }
 
 func (spec *ValhallaSpec) GetResources() *corev1.ResourceRequirements {
@@ -81,13 +153,62 @@ func (spec *ValhallaSpec) GetResources() *corev1.ResourceRequirements {
 	return spec.Resources
 }
 
+func (spec *ValhallaSpec) GetBuilder() *BuilderSpec {
+	if spec.Builder == nil {
+		return &BuilderSpec{}
+	}
+	return spec.Builder
+}
+
+func (spec *ValhallaSpec) GetWorkerPodTemplate() *WorkerPodTemplateSpec {
+	if spec.Workers == nil || spec.Workers.PodTemplate == nil {
+		return &WorkerPodTemplateSpec{}
+	}
+	return spec.Workers.PodTemplate
+}
+
+func (spec *ValhallaSpec) GetWorkers() *WorkersSpec {
+	if spec.Workers == nil {
+		return &WorkersSpec{}
+	}
+	return spec.Workers
+}
+
+func (spec *ValhallaSpec) GetAutoscaling() *AutoscalingSpec {
+	if spec.Autoscaling == nil {
+		return &AutoscalingSpec{}
+	}
+	return spec.Autoscaling
+}
+
 func (spec *ValhallaSpec) GetThreadsPerPod() int32 {
 	if spec.ThreadsPerPod == nil {
-		return 2
+		return defaultThreadsPerPod
 	}
 	return *spec.ThreadsPerPod
 }
 
+// IsAutoscalingEnabled reports whether the workers are scaled by a HorizontalPodAutoscaler,
+// which is the case unless a fixed number of replicas is set.
+func (spec *ValhallaSpec) IsAutoscalingEnabled() bool {
+	return spec.Replicas == nil
+}
+
+func (spec *ValhallaSpec) GetMinReplicas() int32 {
+	if spec.MinReplicas == nil {
+		return defaultMinReplicas
+	}
+	return *spec.MinReplicas
+}
+
+// GetMaxReplicas returns maxReplicas, which defaults to minReplicas.
+func (spec *ValhallaSpec) GetMaxReplicas() int32 {
+	if spec.MaxReplicas == nil {
+		return spec.GetMinReplicas()
+	}
+	return *spec.MaxReplicas
+}
+
 func (spec *ValhallaSpec) GetMinAvailable() *intstr.IntOrString {
 	if spec.MinAvailable != nil {
 		return &intstr.IntOrString{IntVal: *spec.MinAvailable}
@@ -96,15 +217,99 @@ func (spec *ValhallaSpec) GetMinAvailable() *intstr.IntOrString {
 	return &intstr.IntOrString{IntVal: 1}
 }
 
+// GetPBFSources returns all PBF extracts the map is built from,
+// pbfUrl followed by the extracts listed in pbfSources.
+func (spec *ValhallaSpec) GetPBFSources() []PBFSource {
+	sources := []PBFSource{}
+	if spec.PBFURL != "" {
+		sources = append(sources, PBFSource{URL: spec.PBFURL, Checksum: spec.PBFChecksum})
+	}
+	return append(sources, spec.PBFSources...)
+}
+
+func (spec *ValhallaSpec) GetPBFURLs() []string {
+	urls := []string{}
+	for _, source := range spec.GetPBFSources() {
+		urls = append(urls, source.URL)
+	}
+	return urls
+}
+
 func (spec *ValhallaSpec) GetPbfFileName() string {
 	split := strings.Split(spec.PBFURL, "/")
 	return split[len(split)-1]
 }
 
+type PBFSource struct {
+	// URL of a PBF extract, e.g. a Geofabrik region.
+	URL string `json:"url"`
+
+	// Checksum the extract is verified against before the map is built.
+	Checksum *ChecksumSpec `json:"checksum,omitempty"`
+}
+
+// ChecksumSpec is either a literal checksum or the URL of a sidecar file holding one,
+// such as the .md5 files Geofabrik publishes next to each extract.
+type ChecksumSpec struct {
+	// +kubebuilder:validation:Enum=md5;sha256
+	Algorithm string `json:"algorithm,omitempty"`
+	Value     string `json:"value,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+func (spec *ChecksumSpec) GetAlgorithm() string {
+	if spec.Algorithm == "" {
+		return "md5"
+	}
+	return spec.Algorithm
+}
+
+// String encodes the checksum as <algorithm>:<value>, or <algorithm>:<url> for sidecar files.
+func (spec *ChecksumSpec) String() string {
+	if spec.Value != "" {
+		return fmt.Sprintf("%s:%s", spec.GetAlgorithm(), spec.Value)
+	}
+	return fmt.Sprintf("%s:%s", spec.GetAlgorithm(), spec.URL)
+}
+
 type PersistenceSpec struct {
 	StorageClassName string                             `json:"storageClassName,omitempty"`
 	Storage          *resource.Quantity                 `json:"storage,omitempty"`
 	AccessMode       *corev1.PersistentVolumeAccessMode `json:"accessMode,omitempty"`
+
+	// ReclaimPolicy decides what happens to the PersistentVolumeClaim when the instance is deleted.
+	// With Retain it is orphaned and can be adopted by a new instance of the same name. Defaults to Delete.
+	ReclaimPolicy ReclaimPolicy `json:"reclaimPolicy,omitempty"`
+
+	// SnapshotBeforeDeletion takes a VolumeSnapshot of the PersistentVolumeClaim when the instance is deleted.
+	SnapshotBeforeDeletion *VolumeSnapshotSpec `json:"snapshotBeforeDeletion,omitempty"`
+}
+
+// +kubebuilder:validation:Enum=Delete;Retain
+type ReclaimPolicy string
+
+const (
+	ReclaimPolicyDelete ReclaimPolicy = "Delete"
+	ReclaimPolicyRetain ReclaimPolicy = "Retain"
+)
+
+type VolumeSnapshotSpec struct {
+	// VolumeSnapshotClassName is the class of the VolumeSnapshot. The default class is used when it is empty.
+	VolumeSnapshotClassName string `json:"volumeSnapshotClassName,omitempty"`
+}
+
+func (spec *PersistenceSpec) GetStorage() resource.Quantity {
+	if spec.Storage == nil {
+		return resource.MustParse(defaultStorage)
+	}
+	return *spec.Storage
+}
+
+func (spec *PersistenceSpec) GetReclaimPolicy() ReclaimPolicy {
+	if spec.ReclaimPolicy == "" {
+		return ReclaimPolicyDelete
+	}
+	return spec.ReclaimPolicy
 }
 
 func (spec *PersistenceSpec) GetAccessMode() corev1.PersistentVolumeAccessMode {
@@ -120,29 +325,364 @@ type ServiceSpec struct {
 	LoadBalancerIP *string            `json:"loadBalancerIP,omitempty"`
 }
 
+// IngressSpec exposes the workers through a networking.k8s.io/v1 Ingress.
+type IngressSpec struct {
+	IngressClassName *string           `json:"ingressClassName,omitempty"`
+	Host             string            `json:"host,omitempty"`
+	Annotations      map[string]string `json:"annotations,omitempty"`
+
+	// Path is the path prefix routed to the workers. Defaults to /.
+	Path string `json:"path,omitempty"`
+
+	// TLSSecretName is the Secret holding the TLS certificate of the host.
+	TLSSecretName string `json:"tlsSecretName,omitempty"`
+}
+
+func (spec *IngressSpec) GetPath() string {
+	if spec.Path == "" {
+		return defaultPath
+	}
+	return spec.Path
+}
+
+// HTTPRouteSpec exposes the workers through a Gateway API HTTPRoute.
+// TLS is terminated by the listeners of the referenced Gateways.
+type HTTPRouteSpec struct {
+	// ParentRefs are the Gateways the route is attached to.
+	ParentRefs  []GatewayReference `json:"parentRefs"`
+	Hostnames   []string           `json:"hostnames,omitempty"`
+	Annotations map[string]string  `json:"annotations,omitempty"`
+
+	// Path is the path prefix routed to the workers. Defaults to /.
+	Path string `json:"path,omitempty"`
+}
+
+func (spec *HTTPRouteSpec) GetPath() string {
+	if spec.Path == "" {
+		return defaultPath
+	}
+	return spec.Path
+}
+
+type GatewayReference struct {
+	Name string `json:"name"`
+
+	// Namespace of the Gateway. Defaults to the namespace of the Valhalla resource.
+	Namespace string `json:"namespace,omitempty"`
+
+	// SectionName is the listener of the Gateway the route is attached to.
+	SectionName string `json:"sectionName,omitempty"`
+}
+
+// NetworkPolicySpec restricts the traffic of the pods run by the operator. The workers only accept
+// traffic on the Valhalla port, the map builder and predicted traffic pods only reach out for downloads.
+type NetworkPolicySpec struct {
+	// AllowedFrom are the peers allowed to reach the workers. The workers accept traffic
+	// from any peer when empty.
+	AllowedFrom []networkingv1.NetworkPolicyPeer `json:"allowedFrom,omitempty"`
+
+	// DownloadTo are the peers the map builder and predicted traffic pods download from
+	// over HTTP and HTTPS. Any destination is allowed when empty.
+	DownloadTo []networkingv1.NetworkPolicyPeer `json:"downloadTo,omitempty"`
+}
+
 type PredictedTrafficSpec struct {
 	URL      string  `json:"url,omitempty"`
 	Schedule string  `json:"schedule,omitempty"`
 	Image    *string `json:"image,omitempty"`
 }
 
+type MapRefreshSpec struct {
+	// Schedule is a cron expression at which the map is rebuilt from fresh PBF data.
+	Schedule string `json:"schedule,omitempty"`
+}
+
+// BuilderSpec configures the pod of the Job building the map. Changes take effect with the next map build.
+type BuilderSpec struct {
+	Image        *string                      `json:"image,omitempty"`
+	Resources    *corev1.ResourceRequirements `json:"resources,omitempty"`
+	NodeSelector map[string]string            `json:"nodeSelector,omitempty"`
+	Tolerations  []corev1.Toleration          `json:"tolerations,omitempty"`
+	Affinity     *corev1.Affinity             `json:"affinity,omitempty"`
+
+	// ActiveDeadlineSeconds limits the duration of a map build, after which the build fails.
+	ActiveDeadlineSeconds *int64 `json:"activeDeadlineSeconds,omitempty"`
+
+	// BackoffLimit is the number of retries before a map build is considered failed.
+	BackoffLimit *int32 `json:"backoffLimit,omitempty"`
+
+	// TTLSecondsAfterFinished removes finished builder Jobs. The served map version is
+	// recorded once a build completes, so removing completed Jobs does not trigger a rebuild.
+	TTLSecondsAfterFinished *int32 `json:"ttlSecondsAfterFinished,omitempty"`
+
+	// RetryPolicy re-creates the builder Job after a map build failed. Failed builds are
+	// not retried without it, unless requested with the retry-map-build action.
+	RetryPolicy *RetryPolicySpec `json:"retryPolicy,omitempty"`
+}
+
+// RetryPolicySpec retries failed map builds with an exponential backoff.
+type RetryPolicySpec struct {
+	// MaxRetries is the number of times a failed map build is retried. Defaults to 3.
+	// +kubebuilder:validation:Minimum=0
+	MaxRetries *int32 `json:"maxRetries,omitempty"`
+
+	// Backoff is the delay before the first retry, doubled on every further retry. Defaults to 5m.
+	Backoff *metav1.Duration `json:"backoff,omitempty"`
+
+	// MaxBackoff caps the delay between retries. Defaults to 1h.
+	MaxBackoff *metav1.Duration `json:"maxBackoff,omitempty"`
+}
+
+func (spec *RetryPolicySpec) GetMaxRetries() int32 {
+	if spec.MaxRetries == nil {
+		return defaultMaxRetries
+	}
+	return *spec.MaxRetries
+}
+
+// GetBackoff returns the delay before the next retry of a map build that was already retried the given number of times.
+func (spec *RetryPolicySpec) GetBackoff(retries int32) time.Duration {
+	backoff := defaultRetryBackoff
+	if spec.Backoff != nil {
+		backoff = spec.Backoff.Duration
+	}
+	maxBackoff := defaultMaxRetryBackoff
+	if spec.MaxBackoff != nil {
+		maxBackoff = spec.MaxBackoff.Duration
+	}
+	for i := int32(0); i < retries && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		return maxBackoff
+	}
+	return backoff
+}
+
+type WorkersSpec struct {
+	// PodTemplate is applied on top of the pod template generated for the workers.
+	PodTemplate *WorkerPodTemplateSpec `json:"podTemplate,omitempty"`
+
+	// ReadinessProbe replaces the default readiness probe against the /status endpoint.
+	ReadinessProbe *corev1.Probe `json:"readinessProbe,omitempty"`
+
+	// LivenessProbe replaces the default liveness probe against the /status endpoint.
+	LivenessProbe *corev1.Probe `json:"livenessProbe,omitempty"`
+
+	// StartupProbe replaces the default startup probe against the /status endpoint,
+	// which allows the workers 15 minutes to load the tiles.
+	StartupProbe *corev1.Probe `json:"startupProbe,omitempty"`
+}
+
+// WorkerPodTemplateSpec overrides the scheduling, security and environment of the worker pods.
+type WorkerPodTemplateSpec struct {
+	// Labels are added to the worker pods. The labels set by the operator take precedence.
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Annotations are added to the worker pods. The annotations set by the operator take precedence.
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	NodeSelector              map[string]string                 `json:"nodeSelector,omitempty"`
+	Affinity                  *corev1.Affinity                  `json:"affinity,omitempty"`
+	Tolerations               []corev1.Toleration               `json:"tolerations,omitempty"`
+	TopologySpreadConstraints []corev1.TopologySpreadConstraint `json:"topologySpreadConstraints,omitempty"`
+	PriorityClassName         string                            `json:"priorityClassName,omitempty"`
+	ServiceAccountName        string                            `json:"serviceAccountName,omitempty"`
+	SecurityContext           *corev1.PodSecurityContext        `json:"securityContext,omitempty"`
+
+	// ContainerSecurityContext is the security context of the worker container.
+	ContainerSecurityContext *corev1.SecurityContext `json:"containerSecurityContext,omitempty"`
+
+	// Env are added to the environment of the worker container.
+	Env []corev1.EnvVar `json:"env,omitempty"`
+
+	// EnvFrom are added to the environment of the worker container.
+	EnvFrom []corev1.EnvFromSource `json:"envFrom,omitempty"`
+}
+
+// AutoscalingSpec configures the HorizontalPodAutoscaler scaling the workers between minReplicas and maxReplicas.
+type AutoscalingSpec struct {
+	// TargetCPUUtilizationPercentage is the average CPU utilization the workers are scaled to. Defaults to 85.
+	// +kubebuilder:validation:Minimum=1
+	TargetCPUUtilizationPercentage *int32 `json:"targetCPUUtilizationPercentage,omitempty"`
+
+	// TargetMemoryUtilizationPercentage is the average memory utilization the workers are scaled to.
+	// +kubebuilder:validation:Minimum=1
+	TargetMemoryUtilizationPercentage *int32 `json:"targetMemoryUtilizationPercentage,omitempty"`
+
+	// Metrics are additional metrics the workers are scaled on, e.g. requests per second as a Pods or External metric.
+	Metrics []autoscalingv2.MetricSpec `json:"metrics,omitempty"`
+
+	// Behavior configures the stabilization windows and scaling policies in both directions.
+	Behavior *autoscalingv2.HorizontalPodAutoscalerBehavior `json:"behavior,omitempty"`
+}
+
+func (spec *AutoscalingSpec) GetTargetCPUUtilizationPercentage() int32 {
+	if spec.TargetCPUUtilizationPercentage == nil {
+		return defaultTargetCPUUtilizationPercentage
+	}
+	return *spec.TargetCPUUtilizationPercentage
+}
+
+// ScalingWindowSpec overrides the replica bounds of the HorizontalPodAutoscaler for a recurring
+// window, e.g. to scale the workers up ahead of a rush hour. When windows overlap, the first one
+// listed in spec.scalingSchedule is applied.
+type ScalingWindowSpec struct {
+	Name string `json:"name,omitempty"`
+
+	// Schedule is a cron expression at which the window starts.
+	Schedule string `json:"schedule"`
+
+	// Duration is the length of the window, e.g. 2h30m.
+	Duration metav1.Duration `json:"duration"`
+
+	// MinReplicas replaces minReplicas during the window.
+	// +kubebuilder:validation:Minimum=1
+	MinReplicas *int32 `json:"minReplicas,omitempty"`
+
+	// MaxReplicas replaces maxReplicas during the window.
+	// +kubebuilder:validation:Minimum=1
+	MaxReplicas *int32 `json:"maxReplicas,omitempty"`
+}
+
+// ConfigSpec tunes the valhalla.json of the workers. It is merged over the configuration
+// generated by the map builder when a worker starts, so changes roll out without a map rebuild.
+type ConfigSpec struct {
+	// Actions are the service actions the workers serve, e.g. route or isochrone (loki.actions).
+	Actions []string `json:"actions,omitempty"`
+
+	// TimeoutSeconds is the request timeout of the workers (httpd.service.timeout_seconds).
+	TimeoutSeconds *int32 `json:"timeoutSeconds,omitempty"`
+
+	// ServiceLimits overrides the limits of costing models keyed by their name, e.g. auto (service_limits).
+	ServiceLimits map[string]ServiceLimitsSpec `json:"serviceLimits,omitempty"`
+
+	// Overlay is a raw valhalla.json fragment, merged over the settings above.
+	// +kubebuilder:pruning:PreserveUnknownFields
+	Overlay *runtime.RawExtension `json:"overlay,omitempty"`
+}
+
+type ServiceLimitsSpec struct {
+	MaxDistance            *int64 `json:"maxDistance,omitempty"`
+	MaxLocations           *int32 `json:"maxLocations,omitempty"`
+	MaxMatrixDistance      *int64 `json:"maxMatrixDistance,omitempty"`
+	MaxMatrixLocationPairs *int32 `json:"maxMatrixLocationPairs,omitempty"`
+}
+
 // ValhallaStatus defines the observed state of Valhalla
 type ValhallaStatus struct {
 	// Paused is true when the operator notices paused annotation.
 	Paused bool `json:"paused,omitempty"`
 
+	// PausedComponents lists the components paused with their pause annotations, e.g. map-builds.
+	PausedComponents []string `json:"pausedComponents,omitempty"`
+
 	// ObservedGeneration is the latest generation observed by the operator.
 	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
 
 	Phase Phase `json:"phase,omitempty"`
 
+	// MapVersion is the version of the map tiles currently served by the workers.
+	MapVersion string `json:"mapVersion,omitempty"`
+
+	// MapSources are the URLs of the PBF extracts the served map was built from.
+	MapSources []string `json:"mapSources,omitempty"`
+
+	// MapChecksums are the checksums of the PBF extracts the served map was built from,
+	// as computed by the map builder, in the order of MapSources.
+	MapChecksums []string `json:"mapChecksums,omitempty"`
+
+	// MapBuildStartTime is the time the build of the served map started.
+	MapBuildStartTime *metav1.Time `json:"mapBuildStartTime,omitempty"`
+
+	// LastMapBuildTime is the time the most recent map build completed.
+	LastMapBuildTime *metav1.Time `json:"lastMapBuildTime,omitempty"`
+
+	// MapBuildDuration is the time it took to build the served map.
+	MapBuildDuration *metav1.Duration `json:"mapBuildDuration,omitempty"`
+
+	// TileExtractSize is the size of the tile extract of the served map.
+	TileExtractSize *resource.Quantity `json:"tileExtractSize,omitempty"`
+
+	// PredictedTrafficLastUpdateTime is the time the predicted traffic data was last fetched successfully.
+	PredictedTrafficLastUpdateTime *metav1.Time `json:"predictedTrafficLastUpdateTime,omitempty"`
+
+	// PredictedTrafficMapVersion is the map version the predicted traffic data was last fetched into
+	// by a Job the operator started once the version was served, ahead of the next scheduled run.
+	PredictedTrafficMapVersion string `json:"predictedTrafficMapVersion,omitempty"`
+
+	// ServiceEndpoint is the in-cluster address of the workers.
+	ServiceEndpoint string `json:"serviceEndpoint,omitempty"`
+
+	// MapRefreshTime is the time the most recent scheduled or requested map refresh was started.
+	// It mirrors the map-refresh annotation, which the map version is derived from.
+	MapRefreshTime *metav1.Time `json:"mapRefreshTime,omitempty"`
+
+	// MapBuildRetry tracks the retries of a failed map build.
+	MapBuildRetry *MapBuildRetryStatus `json:"mapBuildRetry,omitempty"`
+
+	// WorkersRestartTime is the time a rollout of the workers was last requested with the restart-workers action.
+	WorkersRestartTime *metav1.Time `json:"workersRestartTime,omitempty"`
+
+	// Actions acknowledges the action annotations that were processed.
+	// +listType=map
+	// +listMapKey=name
+	Actions []ActionStatus `json:"actions,omitempty"`
+
 	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
-func (valhallaStatus *ValhallaStatus) SetConditions(resources []runtime.Object) {
+type MapBuildRetryStatus struct {
+	// MapVersion is the map version whose build was retried.
+	MapVersion string `json:"mapVersion,omitempty"`
+
+	// Retries is the number of times the build of the map version was retried.
+	Retries int32 `json:"retries,omitempty"`
+
+	// LastRetryTime is the time the build was last retried.
+	LastRetryTime *metav1.Time `json:"lastRetryTime,omitempty"`
+}
+
+// ActionStatus acknowledges the processing of an action annotation.
+type ActionStatus struct {
+	// Name is the name of the action, e.g. rebuild-map.
+	Name string `json:"name"`
+
+	// Value is the value of the action annotation that was processed last.
+	Value string `json:"value"`
+
+	// ProcessedTime is the time the action was processed.
+	ProcessedTime metav1.Time `json:"processedTime"`
+}
+
+// MapBuildRetries returns the number of times the build of the given map version was retried.
+func (valhallaStatus *ValhallaStatus) MapBuildRetries(mapVersion string) int32 {
+	if valhallaStatus.MapBuildRetry == nil || valhallaStatus.MapBuildRetry.MapVersion != mapVersion {
+		return 0
+	}
+	return valhallaStatus.MapBuildRetry.Retries
+}
+
+// AcknowledgeAction records that the given value of an action annotation was processed.
+func (valhallaStatus *ValhallaStatus) AcknowledgeAction(action, value string) {
+	actionStatus := ActionStatus{Name: action, Value: value, ProcessedTime: metav1.Now()}
+	for i := range valhallaStatus.Actions {
+		if valhallaStatus.Actions[i].Name == action {
+			valhallaStatus.Actions[i] = actionStatus
+			return
+		}
+	}
+	valhallaStatus.Actions = append(valhallaStatus.Actions, actionStatus)
+}
+
+// SetConditions derives the conditions of the instance from its child resources. mapBuildFailure
+// holds the termination messages of the map builder and is reported when the builder Job failed.
+func (valhallaStatus *ValhallaStatus) SetConditions(resources []runtime.Object, desiredMapVersion, mapBuildFailure string) {
 	var oldAvailableCondition *metav1.Condition
 	var oldAllReplicasReadyCondition *metav1.Condition
 	var oldReconciliationSuccessCondition *metav1.Condition
+	var oldMapBuiltCondition *metav1.Condition
+	var oldVolumeResizedCondition *metav1.Condition
 
 	for _, condition := range valhallaStatus.Conditions {
 		switch condition.Type {
@@ -152,6 +692,10 @@ func (valhallaStatus *ValhallaStatus) SetConditions(resources []runtime.Object)
 			oldAvailableCondition = condition.DeepCopy()
 		case status.ConditionReconciliationSuccess:
 			oldReconciliationSuccessCondition = condition.DeepCopy()
+		case status.ConditionMapBuilt:
+			oldMapBuiltCondition = condition.DeepCopy()
+		case status.ConditionVolumeResized:
+			oldVolumeResizedCondition = condition.DeepCopy()
 		}
 	}
 
@@ -164,11 +708,80 @@ func (valhallaStatus *ValhallaStatus) SetConditions(resources []runtime.Object)
 
 	availableCondition := status.AvailableCondition(resources, oldAvailableCondition)
 	allReplicasReadyCondition := status.AllReplicasReadyCondition(resources, oldAllReplicasReadyCondition)
+	mapBuiltCondition := status.MapBuiltCondition(resources, valhallaStatus.MapVersion == desiredMapVersion, mapBuildFailure, oldMapBuiltCondition)
 	valhallaStatus.Conditions = []metav1.Condition{
 		availableCondition,
 		allReplicasReadyCondition,
+		mapBuiltCondition,
 		reconciliationSuccessCondition,
 	}
+	if oldVolumeResizedCondition != nil {
+		valhallaStatus.Conditions = append(valhallaStatus.Conditions, *oldVolumeResizedCondition)
+	}
+}
+
+// SetVolumeResizedCondition reports the progress of the expansion of the PersistentVolumeClaim to the requested storage.
+func (valhallaStatus *ValhallaStatus) SetVolumeResizedCondition(resources []runtime.Object, storage resource.Quantity, expansionAllowed bool) {
+	meta.SetStatusCondition(&valhallaStatus.Conditions, status.VolumeResizedCondition(resources, storage, expansionAllowed))
+}
+
+// SetPhase derives the lifecycle phase of the instance from its child resources
+// and the map version that should be served. An instance that is being deleted is always Deleting.
+func (valhallaStatus *ValhallaStatus) SetPhase(resources []runtime.Object, desiredMapVersion string, deleting bool) {
+	switch {
+	case deleting:
+		valhallaStatus.Phase = PhaseDeleting
+	case status.IsJobFailed(resources):
+		valhallaStatus.Phase = PhaseError
+	case !status.IsPersistentVolumeClaimBound(resources) || valhallaStatus.MapVersion != desiredMapVersion:
+		valhallaStatus.Phase = PhaseBuildingMap
+	case !status.IsDeploymentRolledOut(resources):
+		valhallaStatus.Phase = PhaseDeployingWorkers
+	default:
+		valhallaStatus.Phase = PhaseWorkersDeployed
+	}
+}
+
+// SetChildResourceStatus records the state reported by the child resources,
+// the endpoint of the workers and the last update of the predicted traffic data.
+func (valhallaStatus *ValhallaStatus) SetChildResourceStatus(resources []runtime.Object) {
+	valhallaStatus.ServiceEndpoint = status.ServiceEndpoint(resources)
+	valhallaStatus.PredictedTrafficLastUpdateTime = status.CronJobLastSuccessfulTime(resources)
+}
+
+// SetMapBuild records how the served map was built, from its builder Job and the report of the map builder.
+// The report is nil when the map builder did not write one.
+func (valhallaStatus *ValhallaStatus) SetMapBuild(resources []runtime.Object, report *status.MapBuildReport) {
+	var job *batchv1.Job
+	for _, object := range resources {
+		if j, ok := object.(*batchv1.Job); ok && j != nil {
+			job = j
+			break
+		}
+	}
+
+	completionTime := metav1.Now()
+	valhallaStatus.MapBuildStartTime = nil
+	valhallaStatus.MapBuildDuration = nil
+	if job != nil {
+		if job.Status.CompletionTime != nil {
+			completionTime = *job.Status.CompletionTime
+		}
+		if job.Status.StartTime != nil {
+			valhallaStatus.MapBuildStartTime = job.Status.StartTime.DeepCopy()
+			valhallaStatus.MapBuildDuration = &metav1.Duration{Duration: completionTime.Sub(job.Status.StartTime.Time)}
+		}
+	}
+	valhallaStatus.LastMapBuildTime = &completionTime
+
+	valhallaStatus.MapChecksums = nil
+	valhallaStatus.TileExtractSize = nil
+	if report != nil {
+		valhallaStatus.MapChecksums = report.Checksums
+		if report.TileExtractSize > 0 {
+			valhallaStatus.TileExtractSize = resource.NewQuantity(report.TileExtractSize, resource.BinarySI)
+		}
+	}
 }
 
 func (status *ValhallaStatus) SetCondition(condition metav1.Condition) {
@@ -187,6 +800,10 @@ func (status *ValhallaStatus) SetCondition(condition metav1.Condition) {
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+//+kubebuilder:printcolumn:name="Map Version",type=string,JSONPath=`.status.mapVersion`
+//+kubebuilder:printcolumn:name="Last Map Build",type=date,JSONPath=`.status.lastMapBuildTime`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // Valhalla is the Schema for the valhallas API
 type Valhalla struct {
@@ -201,6 +818,80 @@ func (valhalla Valhalla) ChildResourceName(name string) string {
 	return strings.TrimSuffix(strings.Join([]string{valhalla.Name, name}, "-"), "-")
 }
 
+// IsPaused reports whether the given pause annotation is set to true.
+func (valhalla Valhalla) IsPaused(annotation string) bool {
+	paused, err := strconv.ParseBool(valhalla.GetAnnotations()[annotation])
+	return err == nil && paused
+}
+
+// PausedComponents returns the components paused with their pause annotations, named after the annotations.
+func (valhalla Valhalla) PausedComponents() []string {
+	components := []string{}
+	for _, annotation := range []string{MapBuildsPausedAnnotation, PredictedTrafficPausedAnnotation, WorkersPausedAnnotation} {
+		if valhalla.IsPaused(annotation) {
+			components = append(components, strings.TrimSuffix(strings.TrimPrefix(annotation, "valhalla.itayankri/"), ".paused"))
+		}
+	}
+	return components
+}
+
+// PendingAction returns the value of the annotation of the given action if that value has not been processed yet.
+func (valhalla Valhalla) PendingAction(action string) (string, bool) {
+	value := valhalla.GetAnnotations()[ActionAnnotationPrefix+action]
+	if value == "" {
+		return "", false
+	}
+	for _, actionStatus := range valhalla.Status.Actions {
+		if actionStatus.Name == action {
+			return value, actionStatus.Value != value
+		}
+	}
+	return value, true
+}
+
+// LastMapRefreshTime returns the time the most recent map refresh was started, if any.
+func (valhalla Valhalla) LastMapRefreshTime() (time.Time, bool) {
+	refreshTime, err := time.Parse(time.RFC3339, valhalla.GetAnnotations()[MapRefreshAnnotation])
+	return refreshTime, err == nil
+}
+
+// MapRefreshEnabledTime returns the time spec.mapRefresh was enabled, if it is recorded.
+func (valhalla Valhalla) MapRefreshEnabledTime() (time.Time, bool) {
+	enabledTime, err := time.Parse(time.RFC3339, valhalla.GetAnnotations()[MapRefreshEnabledAnnotation])
+	return enabledTime, err == nil
+}
+
+// DesiredMapVersion returns a short digest of the inputs the map tiles are built from.
+// Every version is built into a directory of its own, so a change in any of the inputs
+// yields a new build while the workers keep serving the current version.
+func (valhalla Valhalla) DesiredMapVersion() string {
+	inputs := valhalla.Spec.mapSourceInputs()
+	if refresh := valhalla.GetAnnotations()[MapRefreshAnnotation]; refresh != "" {
+		inputs = append(inputs, refresh)
+	}
+	hash := sha256.Sum256([]byte(strings.Join(inputs, "\n")))
+	return hex.EncodeToString(hash[:])[:8]
+}
+
+// MapSourcesHash returns a short digest of the PBF sources and their checksums. Unlike the map
+// version, it does not depend on map refreshes, which are recorded in the metadata of the instance.
+func (valhalla Valhalla) MapSourcesHash() string {
+	hash := sha256.Sum256([]byte(strings.Join(valhalla.Spec.mapSourceInputs(), "\n")))
+	return hex.EncodeToString(hash[:])[:8]
+}
+
+func (spec *ValhallaSpec) mapSourceInputs() []string {
+	inputs := []string{}
+	for _, source := range spec.GetPBFSources() {
+		if source.Checksum != nil {
+			inputs = append(inputs, fmt.Sprintf("%s %s", source.URL, source.Checksum))
+		} else {
+			inputs = append(inputs, source.URL)
+		}
+	}
+	return inputs
+}
+
 //+kubebuilder:object:root=true
 
 // ValhallaList contains a list of Valhalla
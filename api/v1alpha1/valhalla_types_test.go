@@ -0,0 +1,248 @@
+package v1alpha1_test
+
+import (
+	"time"
+
+	valhallav1alpha1 "github.com/itayankri/valhalla-operator/api/v1alpha1"
+	"github.com/itayankri/valhalla-operator/internal/status"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+var _ = Describe("ValhallaStatus", func() {
+	Context("SetMapBuild", func() {
+		var valhallaStatus *valhallav1alpha1.ValhallaStatus
+		var childResources []runtime.Object
+		startTime := metav1.NewTime(time.Date(2023, time.March, 1, 12, 0, 0, 0, time.UTC))
+		completionTime := metav1.NewTime(startTime.Add(90 * time.Minute))
+		BeforeEach(func() {
+			valhallaStatus = &valhallav1alpha1.ValhallaStatus{}
+			childResources = []runtime.Object{
+				&batchv1.Job{
+					Status: batchv1.JobStatus{
+						StartTime:      &startTime,
+						CompletionTime: &completionTime,
+					},
+				},
+			}
+		})
+
+		It("Should record the timing of the builder Job and the report of the map builder", func() {
+			valhallaStatus.SetMapBuild(childResources, &status.MapBuildReport{
+				Checksums:       []string{"md5:3b5d5c3712955042212316173ccf37be"},
+				TileExtractSize: 2 * 1024 * 1024 * 1024,
+			})
+			Expect(valhallaStatus.MapBuildStartTime).To(Equal(&startTime))
+			Expect(valhallaStatus.LastMapBuildTime).To(Equal(&completionTime))
+			Expect(valhallaStatus.MapBuildDuration.Duration).To(Equal(90 * time.Minute))
+			Expect(valhallaStatus.MapChecksums).To(Equal([]string{"md5:3b5d5c3712955042212316173ccf37be"}))
+			Expect(valhallaStatus.TileExtractSize.Cmp(resource.MustParse("2Gi"))).To(Equal(0))
+		})
+
+		It("Should clear the details of a previous build without a report", func() {
+			valhallaStatus.MapChecksums = []string{"md5:3b5d5c3712955042212316173ccf37be"}
+			valhallaStatus.TileExtractSize = resource.NewQuantity(1024, resource.BinarySI)
+			valhallaStatus.SetMapBuild(childResources, nil)
+			Expect(valhallaStatus.LastMapBuildTime).To(Equal(&completionTime))
+			Expect(valhallaStatus.MapChecksums).To(BeNil())
+			Expect(valhallaStatus.TileExtractSize).To(BeNil())
+		})
+
+		It("Should record the current time when the builder Job is gone", func() {
+			valhallaStatus.SetMapBuild([]runtime.Object{}, nil)
+			Expect(valhallaStatus.LastMapBuildTime).NotTo(BeNil())
+			Expect(valhallaStatus.MapBuildStartTime).To(BeNil())
+			Expect(valhallaStatus.MapBuildDuration).To(BeNil())
+		})
+	})
+
+	Context("SetConditions", func() {
+		It("Should report a failed map build with the reason of the failure and the termination messages", func() {
+			valhallaStatus := &valhallav1alpha1.ValhallaStatus{MapVersion: "1a2b3c4d"}
+			childResources := []runtime.Object{
+				&batchv1.Job{
+					Status: batchv1.JobStatus{
+						Conditions: []batchv1.JobCondition{
+							{
+								Type:    batchv1.JobFailed,
+								Status:  corev1.ConditionTrue,
+								Reason:  "BackoffLimitExceeded",
+								Message: "Job has reached the specified backoff limit",
+							},
+						},
+					},
+				},
+			}
+			valhallaStatus.SetConditions(childResources, "5e6f7a8b", "checksum mismatch")
+			condition := meta.FindStatusCondition(valhallaStatus.Conditions, status.ConditionMapBuilt)
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+			Expect(condition.Reason).To(Equal("MapBuildFailed"))
+			Expect(condition.Message).To(Equal("BackoffLimitExceeded: Job has reached the specified backoff limit\nchecksum mismatch"))
+		})
+
+		It("Should report a built map once the desired map version is served", func() {
+			valhallaStatus := &valhallav1alpha1.ValhallaStatus{MapVersion: "1a2b3c4d"}
+			valhallaStatus.SetConditions([]runtime.Object{}, "1a2b3c4d", "")
+			condition := meta.FindStatusCondition(valhallaStatus.Conditions, status.ConditionMapBuilt)
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+		})
+	})
+
+	Context("SetPhase", func() {
+		It("Should report a map build while the desired map version is not served", func() {
+			valhallaStatus := &valhallav1alpha1.ValhallaStatus{MapVersion: "1a2b3c4d"}
+			valhallaStatus.SetPhase([]runtime.Object{}, "5e6f7a8b", false)
+			Expect(valhallaStatus.Phase).To(Equal(valhallav1alpha1.PhaseBuildingMap))
+		})
+
+		It("Should report Deleting for an instance that is being deleted", func() {
+			valhallaStatus := &valhallav1alpha1.ValhallaStatus{MapVersion: "1a2b3c4d"}
+			valhallaStatus.SetPhase([]runtime.Object{}, "1a2b3c4d", true)
+			Expect(valhallaStatus.Phase).To(Equal(valhallav1alpha1.PhaseDeleting))
+		})
+	})
+})
+
+var _ = Describe("Valhalla", func() {
+	Context("PendingAction", func() {
+		var instance *valhallav1alpha1.Valhalla
+		BeforeEach(func() {
+			instance = &valhallav1alpha1.Valhalla{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						valhallav1alpha1.ActionAnnotationPrefix + valhallav1alpha1.RestartWorkersAction: "2023-03-01T12:00:00Z",
+					},
+				},
+			}
+		})
+
+		It("Should return an action whose value has not been processed", func() {
+			value, ok := instance.PendingAction(valhallav1alpha1.RestartWorkersAction)
+			Expect(ok).To(BeTrue())
+			Expect(value).To(Equal("2023-03-01T12:00:00Z"))
+		})
+
+		It("Should not return an action that was not requested", func() {
+			_, ok := instance.PendingAction(valhallav1alpha1.RebuildMapAction)
+			Expect(ok).To(BeFalse())
+		})
+
+		It("Should handle every value of an action once", func() {
+			instance.Status.AcknowledgeAction(valhallav1alpha1.RestartWorkersAction, "2023-03-01T12:00:00Z")
+			_, ok := instance.PendingAction(valhallav1alpha1.RestartWorkersAction)
+			Expect(ok).To(BeFalse())
+
+			instance.Annotations[valhallav1alpha1.ActionAnnotationPrefix+valhallav1alpha1.RestartWorkersAction] = "2023-03-02T12:00:00Z"
+			_, ok = instance.PendingAction(valhallav1alpha1.RestartWorkersAction)
+			Expect(ok).To(BeTrue())
+
+			instance.Status.AcknowledgeAction(valhallav1alpha1.RestartWorkersAction, "2023-03-02T12:00:00Z")
+			Expect(instance.Status.Actions).To(HaveLen(1))
+		})
+	})
+})
+
+var _ = Describe("Valhalla map version", func() {
+	It("Should not depend on the status, so that it survives restoring the resource", func() {
+		instance := &valhallav1alpha1.Valhalla{
+			Spec: valhallav1alpha1.ValhallaSpec{
+				PBFURL: "https://download.geofabrik.de/australia-oceania/marshall-islands-latest.osm.pbf",
+			},
+		}
+		version := instance.DesiredMapVersion()
+		instance.Status = valhallav1alpha1.ValhallaStatus{
+			MapVersion:     "1a2b3c4d",
+			MapRefreshTime: &metav1.Time{Time: time.Now()},
+		}
+		Expect(instance.DesiredMapVersion()).To(Equal(version))
+	})
+
+	It("Should change when a map refresh is started", func() {
+		instance := &valhallav1alpha1.Valhalla{
+			Spec: valhallav1alpha1.ValhallaSpec{
+				PBFURL: "https://download.geofabrik.de/australia-oceania/marshall-islands-latest.osm.pbf",
+			},
+		}
+		version := instance.DesiredMapVersion()
+		instance.Annotations = map[string]string{valhallav1alpha1.MapRefreshAnnotation: "2023-03-01T12:00:00Z"}
+		Expect(instance.DesiredMapVersion()).NotTo(Equal(version))
+
+		refreshTime, ok := instance.LastMapRefreshTime()
+		Expect(ok).To(BeTrue())
+		Expect(refreshTime).To(Equal(time.Date(2023, time.March, 1, 12, 0, 0, 0, time.UTC)))
+	})
+
+	It("Should not change when map refreshes are enabled", func() {
+		instance := &valhallav1alpha1.Valhalla{
+			Spec: valhallav1alpha1.ValhallaSpec{
+				PBFURL: "https://download.geofabrik.de/australia-oceania/marshall-islands-latest.osm.pbf",
+			},
+		}
+		version := instance.DesiredMapVersion()
+		instance.Annotations = map[string]string{valhallav1alpha1.MapRefreshEnabledAnnotation: "2023-03-01T12:00:00Z"}
+		Expect(instance.DesiredMapVersion()).To(Equal(version))
+
+		enabledTime, ok := instance.MapRefreshEnabledTime()
+		Expect(ok).To(BeTrue())
+		Expect(enabledTime).To(Equal(time.Date(2023, time.March, 1, 12, 0, 0, 0, time.UTC)))
+	})
+
+	It("Should hash the map sources independently of map refreshes", func() {
+		instance := &valhallav1alpha1.Valhalla{
+			Spec: valhallav1alpha1.ValhallaSpec{
+				PBFURL: "https://download.geofabrik.de/australia-oceania/marshall-islands-latest.osm.pbf",
+			},
+		}
+		sourcesHash := instance.MapSourcesHash()
+		instance.Annotations = map[string]string{valhallav1alpha1.MapRefreshAnnotation: "2023-03-01T12:00:00Z"}
+		Expect(instance.MapSourcesHash()).To(Equal(sourcesHash))
+
+		instance.Spec.PBFURL = "https://download.geofabrik.de/australia-oceania/fiji-latest.osm.pbf"
+		Expect(instance.MapSourcesHash()).NotTo(Equal(sourcesHash))
+	})
+})
+
+var _ = Describe("Valhalla pause annotations", func() {
+	It("Should list the paused components", func() {
+		instance := &valhallav1alpha1.Valhalla{
+			ObjectMeta: metav1.ObjectMeta{
+				Annotations: map[string]string{
+					valhallav1alpha1.MapBuildsPausedAnnotation:        "true",
+					valhallav1alpha1.PredictedTrafficPausedAnnotation: "false",
+					valhallav1alpha1.WorkersPausedAnnotation:          "yes",
+				},
+			},
+		}
+		Expect(instance.PausedComponents()).To(Equal([]string{"map-builds"}))
+	})
+})
+
+var _ = Describe("RetryPolicySpec", func() {
+	Context("GetBackoff", func() {
+		It("Should double the backoff on every retry up to maxBackoff", func() {
+			retryPolicy := &valhallav1alpha1.RetryPolicySpec{
+				Backoff:    &metav1.Duration{Duration: time.Minute},
+				MaxBackoff: &metav1.Duration{Duration: 5 * time.Minute},
+			}
+			Expect(retryPolicy.GetBackoff(0)).To(Equal(time.Minute))
+			Expect(retryPolicy.GetBackoff(1)).To(Equal(2 * time.Minute))
+			Expect(retryPolicy.GetBackoff(2)).To(Equal(4 * time.Minute))
+			Expect(retryPolicy.GetBackoff(3)).To(Equal(5 * time.Minute))
+		})
+
+		It("Should default to a backoff of 5 minutes up to an hour", func() {
+			retryPolicy := &valhallav1alpha1.RetryPolicySpec{}
+			Expect(retryPolicy.GetMaxRetries()).To(Equal(int32(3)))
+			Expect(retryPolicy.GetBackoff(0)).To(Equal(5 * time.Minute))
+			Expect(retryPolicy.GetBackoff(10)).To(Equal(time.Hour))
+		})
+	})
+})
@@ -0,0 +1,232 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/robfig/cron/v3"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// log is for logging in this package.
+var valhallalog = logf.Log.WithName("valhalla-resource")
+
+func (r *Valhalla) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/mutate-valhalla-itayankri-v1alpha1-valhalla,mutating=true,failurePolicy=fail,sideEffects=None,groups=valhalla.itayankri,resources=valhallas,verbs=create;update,versions=v1alpha1,name=mvalhalla.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Defaulter = &Valhalla{}
+
+// Default implements webhook.Defaulter so a webhook will be registered for the type
+func (r *Valhalla) Default() {
+	valhallalog.Info("default", "name", r.Name)
+
+	if r.Spec.IsAutoscalingEnabled() && r.Spec.MinReplicas == nil {
+		minReplicas := defaultMinReplicas
+		r.Spec.MinReplicas = &minReplicas
+	}
+
+	if r.Spec.IsAutoscalingEnabled() && r.Spec.MaxReplicas == nil {
+		maxReplicas := *r.Spec.MinReplicas
+		r.Spec.MaxReplicas = &maxReplicas
+	}
+
+	if r.Spec.ThreadsPerPod == nil {
+		threadsPerPod := r.Spec.GetThreadsPerPod()
+		r.Spec.ThreadsPerPod = &threadsPerPod
+	}
+
+	if r.Spec.Persistence.Storage == nil {
+		storage := r.Spec.Persistence.GetStorage()
+		r.Spec.Persistence.Storage = &storage
+	}
+}
+
+//+kubebuilder:webhook:path=/validate-valhalla-itayankri-v1alpha1-valhalla,mutating=false,failurePolicy=fail,sideEffects=None,groups=valhalla.itayankri,resources=valhallas,verbs=create;update,versions=v1alpha1,name=vvalhalla.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Validator = &Valhalla{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *Valhalla) ValidateCreate() error {
+	valhallalog.Info("validate create", "name", r.Name)
+
+	return r.toInvalidError(r.validateSpec())
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *Valhalla) ValidateUpdate(old runtime.Object) error {
+	valhallalog.Info("validate update", "name", r.Name)
+
+	// Updates of the metadata or status only, such as the operator removing its finalizer,
+	// must not be blocked by a spec that was admitted before the current rules existed.
+	oldValhalla := old.(*Valhalla)
+	if r.DeletionTimestamp != nil || equality.Semantic.DeepEqual(r.Spec, oldValhalla.Spec) {
+		return nil
+	}
+
+	allErrs := r.validateSpec()
+	allErrs = append(allErrs, r.validateImmutableFields(oldValhalla)...)
+	return r.toInvalidError(allErrs)
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *Valhalla) ValidateDelete() error {
+	valhallalog.Info("validate delete", "name", r.Name)
+
+	return nil
+}
+
+func (r *Valhalla) validateSpec() field.ErrorList {
+	var allErrs field.ErrorList
+	specPath := field.NewPath("spec")
+
+	if len(r.Spec.GetPBFSources()) == 0 {
+		allErrs = append(allErrs, field.Required(specPath.Child("pbfUrl"), "either pbfUrl or pbfSources must be set"))
+	}
+
+	for i, source := range r.Spec.PBFSources {
+		if source.URL == "" {
+			allErrs = append(allErrs, field.Required(specPath.Child("pbfSources").Index(i).Child("url"), ""))
+		}
+		allErrs = append(allErrs, validateChecksum(source.Checksum, specPath.Child("pbfSources").Index(i).Child("checksum"))...)
+	}
+	allErrs = append(allErrs, validateChecksum(r.Spec.PBFChecksum, specPath.Child("pbfChecksum"))...)
+
+	if r.Spec.Replicas != nil && r.Spec.Autoscaling != nil {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("autoscaling"), "autoscaling must not be set together with replicas"))
+	}
+
+	if r.Spec.MinReplicas != nil && r.Spec.MaxReplicas != nil && *r.Spec.MinReplicas > *r.Spec.MaxReplicas {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("minReplicas"), *r.Spec.MinReplicas,
+			"minReplicas must not be greater than maxReplicas"))
+	}
+
+	if r.Spec.PredictedTraffic != nil {
+		allErrs = append(allErrs, validateSchedule(r.Spec.PredictedTraffic.Schedule, specPath.Child("predictedTraffic", "schedule"))...)
+	}
+
+	if r.Spec.Replicas != nil && len(r.Spec.ScalingSchedule) > 0 {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("scalingSchedule"), "scalingSchedule must not be set together with replicas"))
+	}
+
+	for i, window := range r.Spec.ScalingSchedule {
+		windowPath := specPath.Child("scalingSchedule").Index(i)
+		allErrs = append(allErrs, validateSchedule(window.Schedule, windowPath.Child("schedule"))...)
+		if window.Duration.Duration <= 0 {
+			allErrs = append(allErrs, field.Invalid(windowPath.Child("duration"), window.Duration.String(), "duration must be positive"))
+		}
+		if window.MinReplicas != nil && *window.MinReplicas < 1 {
+			allErrs = append(allErrs, field.Invalid(windowPath.Child("minReplicas"), *window.MinReplicas, "minReplicas must be at least 1"))
+		}
+		if window.MaxReplicas != nil && *window.MaxReplicas < 1 {
+			allErrs = append(allErrs, field.Invalid(windowPath.Child("maxReplicas"), *window.MaxReplicas, "maxReplicas must be at least 1"))
+		}
+		if window.MinReplicas != nil && window.MaxReplicas != nil && *window.MinReplicas > *window.MaxReplicas {
+			allErrs = append(allErrs, field.Invalid(windowPath.Child("minReplicas"), *window.MinReplicas,
+				"minReplicas must not be greater than maxReplicas"))
+		}
+	}
+
+	if r.Spec.HTTPRoute != nil && len(r.Spec.HTTPRoute.ParentRefs) == 0 {
+		allErrs = append(allErrs, field.Required(specPath.Child("httpRoute", "parentRefs"), "at least one Gateway must be referenced"))
+	}
+
+	if r.Spec.MapRefresh != nil {
+		allErrs = append(allErrs, validateSchedule(r.Spec.MapRefresh.Schedule, specPath.Child("mapRefresh", "schedule"))...)
+	}
+
+	if r.Spec.Builder != nil && r.Spec.Builder.RetryPolicy != nil {
+		retryPolicyPath := specPath.Child("builder", "retryPolicy")
+		retryPolicy := r.Spec.Builder.RetryPolicy
+		if retryPolicy.Backoff != nil && retryPolicy.Backoff.Duration <= 0 {
+			allErrs = append(allErrs, field.Invalid(retryPolicyPath.Child("backoff"), retryPolicy.Backoff.String(), "backoff must be positive"))
+		}
+		if retryPolicy.Backoff != nil && retryPolicy.MaxBackoff != nil && retryPolicy.MaxBackoff.Duration < retryPolicy.Backoff.Duration {
+			allErrs = append(allErrs, field.Invalid(retryPolicyPath.Child("maxBackoff"), retryPolicy.MaxBackoff.String(),
+				"maxBackoff must not be less than backoff"))
+		}
+	}
+
+	if r.Spec.Config != nil && r.Spec.Config.Overlay != nil {
+		overlay := map[string]interface{}{}
+		if err := json.Unmarshal(r.Spec.Config.Overlay.Raw, &overlay); err != nil {
+			allErrs = append(allErrs, field.Invalid(specPath.Child("config", "overlay"), string(r.Spec.Config.Overlay.Raw),
+				"overlay must be a JSON object"))
+		}
+	}
+
+	return allErrs
+}
+
+// validateImmutableFields rejects changes to fields that cannot be applied to existing child resources.
+func (r *Valhalla) validateImmutableFields(old *Valhalla) field.ErrorList {
+	var allErrs field.ErrorList
+	persistencePath := field.NewPath("spec", "persistence")
+
+	if r.Spec.Persistence.StorageClassName != old.Spec.Persistence.StorageClassName {
+		allErrs = append(allErrs, field.Forbidden(persistencePath.Child("storageClassName"), "field is immutable"))
+	}
+
+	// A PersistentVolumeClaim can be expanded but never shrunk.
+	if storage, oldStorage := r.Spec.Persistence.GetStorage(), old.Spec.Persistence.GetStorage(); storage.Cmp(oldStorage) < 0 {
+		allErrs = append(allErrs, field.Forbidden(persistencePath.Child("storage"),
+			fmt.Sprintf("storage must not be decreased below %s", oldStorage.String())))
+	}
+
+	if r.Spec.Persistence.GetAccessMode() != old.Spec.Persistence.GetAccessMode() {
+		allErrs = append(allErrs, field.Forbidden(persistencePath.Child("accessMode"), "field is immutable"))
+	}
+
+	return allErrs
+}
+
+func (r *Valhalla) toInvalidError(allErrs field.ErrorList) error {
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(schema.GroupKind{Group: GroupVersion.Group, Kind: "Valhalla"}, r.Name, allErrs)
+}
+
+func validateSchedule(schedule string, fldPath *field.Path) field.ErrorList {
+	if _, err := cron.ParseStandard(schedule); err != nil {
+		return field.ErrorList{field.Invalid(fldPath, schedule, err.Error())}
+	}
+	return nil
+}
+
+func validateChecksum(checksum *ChecksumSpec, fldPath *field.Path) field.ErrorList {
+	if checksum == nil {
+		return nil
+	}
+	if (checksum.Value == "") == (checksum.URL == "") {
+		return field.ErrorList{field.Invalid(fldPath, checksum.String(), "exactly one of value or url must be set")}
+	}
+	return nil
+}
@@ -0,0 +1,229 @@
+package v1alpha1_test
+
+import (
+	"time"
+
+	valhallav1alpha1 "github.com/itayankri/valhalla-operator/api/v1alpha1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/pointer"
+)
+
+var _ = Describe("Valhalla webhook", func() {
+	var instance *valhallav1alpha1.Valhalla
+	BeforeEach(func() {
+		instance = &valhallav1alpha1.Valhalla{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test",
+				Namespace: "default",
+			},
+			Spec: valhallav1alpha1.ValhallaSpec{
+				PBFURL: "https://download.geofabrik.de/australia-oceania/marshall-islands-latest.osm.pbf",
+			},
+		}
+	})
+
+	Context("Default", func() {
+		It("Should default replicas, threads and storage", func() {
+			instance.Default()
+			Expect(instance.Spec.MinReplicas).To(Equal(pointer.Int32Ptr(1)))
+			Expect(instance.Spec.MaxReplicas).To(Equal(pointer.Int32Ptr(1)))
+			Expect(instance.Spec.ThreadsPerPod).To(Equal(pointer.Int32Ptr(2)))
+			Expect(instance.Spec.Persistence.Storage.String()).To(Equal("10Gi"))
+		})
+
+		It("Should default maxReplicas to minReplicas", func() {
+			instance.Spec.MinReplicas = pointer.Int32Ptr(3)
+			instance.Default()
+			Expect(instance.Spec.MaxReplicas).To(Equal(pointer.Int32Ptr(3)))
+		})
+
+		It("Should not default minReplicas and maxReplicas for a fixed number of replicas", func() {
+			instance.Spec.Replicas = pointer.Int32Ptr(1)
+			instance.Default()
+			Expect(instance.Spec.MinReplicas).To(BeNil())
+			Expect(instance.Spec.MaxReplicas).To(BeNil())
+		})
+
+		It("Should not override values set in the spec", func() {
+			storage := resource.MustParse("1Gi")
+			instance.Spec.MinReplicas = pointer.Int32Ptr(2)
+			instance.Spec.MaxReplicas = pointer.Int32Ptr(5)
+			instance.Spec.ThreadsPerPod = pointer.Int32Ptr(4)
+			instance.Spec.Persistence.Storage = &storage
+			instance.Default()
+			Expect(instance.Spec.MinReplicas).To(Equal(pointer.Int32Ptr(2)))
+			Expect(instance.Spec.MaxReplicas).To(Equal(pointer.Int32Ptr(5)))
+			Expect(instance.Spec.ThreadsPerPod).To(Equal(pointer.Int32Ptr(4)))
+			Expect(instance.Spec.Persistence.Storage.String()).To(Equal("1Gi"))
+		})
+	})
+
+	Context("ValidateCreate", func() {
+		It("Should accept a valid spec", func() {
+			Expect(instance.ValidateCreate()).To(Succeed())
+		})
+
+		It("Should reject a spec without PBF sources", func() {
+			instance.Spec.PBFURL = ""
+			Expect(instance.ValidateCreate()).To(MatchError(ContainSubstring("either pbfUrl or pbfSources must be set")))
+		})
+
+		It("Should reject minReplicas greater than maxReplicas", func() {
+			instance.Spec.MinReplicas = pointer.Int32Ptr(3)
+			instance.Spec.MaxReplicas = pointer.Int32Ptr(2)
+			Expect(instance.ValidateCreate()).To(MatchError(ContainSubstring("minReplicas must not be greater than maxReplicas")))
+		})
+
+		It("Should reject autoscaling together with a fixed number of replicas", func() {
+			instance.Spec.Replicas = pointer.Int32Ptr(1)
+			instance.Spec.Autoscaling = &valhallav1alpha1.AutoscalingSpec{}
+			Expect(instance.ValidateCreate()).To(MatchError(ContainSubstring("autoscaling must not be set together with replicas")))
+		})
+
+		It("Should reject a malformed predicted traffic schedule", func() {
+			instance.Spec.PredictedTraffic = &valhallav1alpha1.PredictedTrafficSpec{
+				URL:      "https://example.com",
+				Schedule: "every day",
+			}
+			Expect(instance.ValidateCreate()).To(MatchError(ContainSubstring("spec.predictedTraffic.schedule")))
+		})
+
+		It("Should reject a scaling window without a positive duration", func() {
+			instance.Spec.ScalingSchedule = []valhallav1alpha1.ScalingWindowSpec{
+				{Schedule: "0 7 * * 1-5"},
+			}
+			Expect(instance.ValidateCreate()).To(MatchError(ContainSubstring("duration must be positive")))
+		})
+
+		It("Should reject a malformed scaling window schedule", func() {
+			instance.Spec.ScalingSchedule = []valhallav1alpha1.ScalingWindowSpec{
+				{Schedule: "weekdays", Duration: metav1.Duration{Duration: time.Hour}},
+			}
+			Expect(instance.ValidateCreate()).To(MatchError(ContainSubstring("spec.scalingSchedule[0].schedule")))
+		})
+
+		It("Should reject a scaling window with less than one replica", func() {
+			minReplicas := int32(0)
+			instance.Spec.ScalingSchedule = []valhallav1alpha1.ScalingWindowSpec{
+				{Schedule: "0 7 * * 1-5", Duration: metav1.Duration{Duration: time.Hour}, MinReplicas: &minReplicas},
+			}
+			Expect(instance.ValidateCreate()).To(MatchError(ContainSubstring("spec.scalingSchedule[0].minReplicas")))
+		})
+
+		It("Should reject a scaling window with minReplicas greater than its maxReplicas", func() {
+			minReplicas, maxReplicas := int32(5), int32(3)
+			instance.Spec.ScalingSchedule = []valhallav1alpha1.ScalingWindowSpec{
+				{Schedule: "0 7 * * 1-5", Duration: metav1.Duration{Duration: time.Hour}, MinReplicas: &minReplicas, MaxReplicas: &maxReplicas},
+			}
+			Expect(instance.ValidateCreate()).To(MatchError(ContainSubstring("minReplicas must not be greater than maxReplicas")))
+		})
+
+		It("Should accept a scaling window that only raises minReplicas", func() {
+			minReplicas := int32(5)
+			instance.Spec.ScalingSchedule = []valhallav1alpha1.ScalingWindowSpec{
+				{Schedule: "0 7 * * 1-5", Duration: metav1.Duration{Duration: time.Hour}, MinReplicas: &minReplicas},
+			}
+			Expect(instance.ValidateCreate()).To(Succeed())
+		})
+
+		It("Should reject an HTTPRoute without Gateways", func() {
+			instance.Spec.HTTPRoute = &valhallav1alpha1.HTTPRouteSpec{Hostnames: []string{"routing.example.com"}}
+			Expect(instance.ValidateCreate()).To(MatchError(ContainSubstring("at least one Gateway must be referenced")))
+		})
+
+		It("Should reject a malformed map refresh schedule", func() {
+			instance.Spec.MapRefresh = &valhallav1alpha1.MapRefreshSpec{Schedule: "* * *"}
+			Expect(instance.ValidateCreate()).To(MatchError(ContainSubstring("spec.mapRefresh.schedule")))
+		})
+
+		It("Should reject a retry policy with a maxBackoff less than its backoff", func() {
+			instance.Spec.Builder = &valhallav1alpha1.BuilderSpec{
+				RetryPolicy: &valhallav1alpha1.RetryPolicySpec{
+					Backoff:    &metav1.Duration{Duration: time.Hour},
+					MaxBackoff: &metav1.Duration{Duration: time.Minute},
+				},
+			}
+			Expect(instance.ValidateCreate()).To(MatchError(ContainSubstring("maxBackoff must not be less than backoff")))
+		})
+
+		It("Should reject a checksum with both a value and a URL", func() {
+			instance.Spec.PBFChecksum = &valhallav1alpha1.ChecksumSpec{
+				Value: "abcdef",
+				URL:   "https://download.geofabrik.de/australia-oceania/marshall-islands-latest.osm.pbf.md5",
+			}
+			Expect(instance.ValidateCreate()).To(MatchError(ContainSubstring("exactly one of value or url must be set")))
+		})
+	})
+
+	Context("ValidateCreate config", func() {
+		It("Should reject a config overlay that is not a JSON object", func() {
+			instance.Spec.Config = &valhallav1alpha1.ConfigSpec{
+				Overlay: &runtime.RawExtension{Raw: []byte(`"route"`)},
+			}
+			Expect(instance.ValidateCreate()).To(MatchError(ContainSubstring("overlay must be a JSON object")))
+		})
+
+		It("Should accept a config overlay that is a JSON object", func() {
+			instance.Spec.Config = &valhallav1alpha1.ConfigSpec{
+				Overlay: &runtime.RawExtension{Raw: []byte(`{"loki": {"actions": ["route"]}}`)},
+			}
+			Expect(instance.ValidateCreate()).To(Succeed())
+		})
+	})
+
+	Context("ValidateUpdate", func() {
+		It("Should reject a change of the storage class", func() {
+			old := instance.DeepCopy()
+			instance.Spec.Persistence.StorageClassName = "fast"
+			Expect(instance.ValidateUpdate(old)).To(MatchError(ContainSubstring("spec.persistence.storageClassName")))
+		})
+
+		It("Should reject a change of the access mode", func() {
+			old := instance.DeepCopy()
+			accessMode := corev1.ReadWriteMany
+			instance.Spec.Persistence.AccessMode = &accessMode
+			Expect(instance.ValidateUpdate(old)).To(MatchError(ContainSubstring("spec.persistence.accessMode")))
+		})
+
+		It("Should reject shrinking the storage", func() {
+			storage := resource.MustParse("20Gi")
+			instance.Spec.Persistence.Storage = &storage
+			old := instance.DeepCopy()
+			smallerStorage := resource.MustParse("10Gi")
+			instance.Spec.Persistence.Storage = &smallerStorage
+			Expect(instance.ValidateUpdate(old)).To(MatchError(ContainSubstring("storage must not be decreased below 20Gi")))
+		})
+
+		It("Should accept growing the storage", func() {
+			old := instance.DeepCopy()
+			storage := resource.MustParse("100Gi")
+			instance.Spec.Persistence.Storage = &storage
+			Expect(instance.ValidateUpdate(old)).To(Succeed())
+		})
+
+		It("Should accept a metadata update of a resource whose spec is no longer valid", func() {
+			instance.Spec.PBFURL = ""
+			old := instance.DeepCopy()
+			instance.Finalizers = []string{"valhalla.itayankri/finalizer"}
+			Expect(instance.ValidateUpdate(old)).To(Succeed())
+		})
+
+		It("Should accept any update of a resource that is being deleted", func() {
+			old := instance.DeepCopy()
+			instance.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+			instance.Spec.Persistence.StorageClassName = "fast"
+			Expect(instance.ValidateUpdate(old)).To(Succeed())
+		})
+
+		It("Should accept a change of the PBF URL", func() {
+			old := instance.DeepCopy()
+			instance.Spec.PBFURL = "https://download.geofabrik.de/europe/monaco-latest.osm.pbf"
+			Expect(instance.ValidateUpdate(old)).To(Succeed())
+		})
+	})
+})
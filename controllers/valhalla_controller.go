@@ -18,26 +18,38 @@ package controllers
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"strconv"
+	"strings"
 	"time"
 
 	"github.com/itayankri/valhalla-operator/internal/resource"
 	"github.com/itayankri/valhalla-operator/internal/status"
+	"github.com/robfig/cron/v3"
 	appsv1 "k8s.io/api/apps/v1"
-	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 	policyv1 "k8s.io/api/policy/v1"
+	storagev1 "k8s.io/api/storage/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	clientretry "k8s.io/client-go/util/retry"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	"github.com/go-logr/logr"
 	valhallav1alpha1 "github.com/itayankri/valhalla-operator/api/v1alpha1"
@@ -45,18 +57,30 @@ import (
 
 const finalizerName = "valhalla.itayankri/finalizer"
 
+// pendingActionRequeueInterval is the interval at which actions that cannot be performed yet are retried.
+const pendingActionRequeueInterval = 30 * time.Second
+
+// volumeReleaseRequeueInterval is the interval at which the release of the volume of a deleted instance is retried.
+const volumeReleaseRequeueInterval = 5 * time.Second
+
 // ValhallaReconciler reconciles a Valhalla object
 type ValhallaReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
-	log    logr.Logger
+	// APIReader reads objects directly from the API server, bypassing the cache of the Client.
+	// It is used for kinds the operator must not cache cluster-wide, such as Secrets.
+	APIReader client.Reader
+	Scheme    *runtime.Scheme
+	Recorder  record.EventRecorder
+	log       logr.Logger
 }
 
-func NewValhallaReconciler(client client.Client, scheme *runtime.Scheme) *ValhallaReconciler {
+func NewValhallaReconciler(client client.Client, apiReader client.Reader, scheme *runtime.Scheme, recorder record.EventRecorder) *ValhallaReconciler {
 	return &ValhallaReconciler{
-		Client: client,
-		Scheme: scheme,
-		log:    ctrl.Log.WithName("controller").WithName("valhalla"),
+		Client:    client,
+		APIReader: apiReader,
+		Scheme:    scheme,
+		Recorder:  recorder,
+		log:       ctrl.Log.WithName("controller").WithName("valhalla"),
 	}
 }
 
@@ -64,15 +88,23 @@ func NewValhallaReconciler(client client.Client, scheme *runtime.Scheme) *Valhal
 // +kubebuilder:rbac:groups="",resources=pods/exec,verbs=create
 // +kubebuilder:rbac:groups="",resources=pods,verbs=update;get;list;watch
 // +kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch;create;update
-// +kubebuilder:rbac:groups="batch",resources=jobs,verbs=get;list;watch;create;update
-// +kubebuilder:rbac:groups="batch",resources=cronjobs,verbs=get;list;watch;create;update
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update
+// +kubebuilder:rbac:groups="networking.k8s.io",resources=ingresses,verbs=get;list;watch;create;update;delete
+// +kubebuilder:rbac:groups="networking.k8s.io",resources=networkpolicies,verbs=get;list;watch;create;update;delete
+// +kubebuilder:rbac:groups="gateway.networking.k8s.io",resources=httproutes,verbs=get;list;watch;create;update;delete
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
+// +kubebuilder:rbac:groups="batch",resources=jobs,verbs=get;list;watch;create;update;delete
+// +kubebuilder:rbac:groups="batch",resources=cronjobs,verbs=get;list;watch;create;update;delete
 // +kubebuilder:rbac:groups="apps",resources=deployments,verbs=get;list;watch;create;update
-// +kubebuilder:rbac:groups="autoscaling",resources=horizontalpodautoscalers,verbs=get;list;watch;create;update
+// +kubebuilder:rbac:groups="autoscaling",resources=horizontalpodautoscalers,verbs=get;list;watch;create;update;delete
 // +kubebuilder:rbac:groups="policy",resources=poddisruptionbudgets,verbs=get;list;watch;create;update
 // +kubebuilder:rbac:groups=valhalla.itayankri,resources=valhallas,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=valhalla.itayankri,resources=valhallas/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=valhalla.itayankri,resources=valhallas/finalizers,verbs=update
 // +kubebuilder:rbac:groups="",resources=persistentvolumeclaims,verbs=get;list;watch;create;update
+// +kubebuilder:rbac:groups="snapshot.storage.k8s.io",resources=volumesnapshots,verbs=get;create
+// +kubebuilder:rbac:groups="storage.k8s.io",resources=storageclasses,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 // +kubebuilder:rbac:groups="rbac.authorization.k8s.io",resources=roles,verbs=get;list;watch;create;update
 // +kubebuilder:rbac:groups="rbac.authorization.k8s.io",resources=rolebindings,verbs=get;list;watch;create;update
 
@@ -105,7 +137,7 @@ func (r *ValhallaReconciler) getChildResources(ctx context.Context, instance *va
 
 	job := &batchv1.Job{}
 	if err := r.Client.Get(ctx, types.NamespacedName{
-		Name:      instance.ChildResourceName(resource.JobSuffix),
+		Name:      resource.MapBuilderJobName(instance),
 		Namespace: instance.Namespace,
 	}, job); err != nil && !errors.IsNotFound(err) {
 		return nil, err
@@ -113,6 +145,16 @@ func (r *ValhallaReconciler) getChildResources(ctx context.Context, instance *va
 		job = nil
 	}
 
+	cronJob := &batchv1.CronJob{}
+	if err := r.Client.Get(ctx, types.NamespacedName{
+		Name:      instance.ChildResourceName(resource.CronJobSuffix),
+		Namespace: instance.Namespace,
+	}, cronJob); err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	} else if errors.IsNotFound(err) {
+		cronJob = nil
+	}
+
 	deployment := &appsv1.Deployment{}
 	if err := r.Client.Get(ctx, types.NamespacedName{
 		Name:      instance.ChildResourceName(resource.DeploymentSuffix),
@@ -123,7 +165,7 @@ func (r *ValhallaReconciler) getChildResources(ctx context.Context, instance *va
 		deployment = nil
 	}
 
-	hpa := &autoscalingv1.HorizontalPodAutoscaler{}
+	hpa := &autoscalingv2.HorizontalPodAutoscaler{}
 	if err := r.Client.Get(ctx, types.NamespacedName{
 		Name:      instance.ChildResourceName(resource.HorizontalPodAutoscalerSuffix),
 		Namespace: instance.Namespace,
@@ -143,7 +185,27 @@ func (r *ValhallaReconciler) getChildResources(ctx context.Context, instance *va
 		service = nil
 	}
 
-	return []runtime.Object{pvc, job, deployment, hpa, service}, nil
+	return []runtime.Object{pvc, job, cronJob, deployment, hpa, service}, nil
+}
+
+// isVolumeExpansionAllowed reports whether the StorageClass of the PersistentVolumeClaim allows volume expansion.
+func (r *ValhallaReconciler) isVolumeExpansionAllowed(ctx context.Context, childResources []runtime.Object) (bool, error) {
+	for _, object := range childResources {
+		pvc, ok := object.(*corev1.PersistentVolumeClaim)
+		if !ok {
+			continue
+		}
+		if pvc == nil || pvc.Spec.StorageClassName == nil || *pvc.Spec.StorageClassName == "" {
+			return false, nil
+		}
+
+		storageClass := &storagev1.StorageClass{}
+		if err := r.Client.Get(ctx, types.NamespacedName{Name: *pvc.Spec.StorageClassName}, storageClass); err != nil {
+			return false, client.IgnoreNotFound(err)
+		}
+		return storageClass.AllowVolumeExpansion != nil && *storageClass.AllowVolumeExpansion, nil
+	}
+	return false, nil
 }
 
 func (r *ValhallaReconciler) initialize(ctx context.Context, instance *valhallav1alpha1.Valhalla) error {
@@ -155,8 +217,20 @@ func (r *ValhallaReconciler) updateValhallaStatusConditions(
 	ctx context.Context,
 	instance *valhallav1alpha1.Valhalla,
 	childResources []runtime.Object,
+	volumeExpansionAllowed bool,
 ) (time.Duration, error) {
-	instance.Status.SetConditions(childResources)
+	mapBuildFailure := ""
+	if status.IsJobFailed(childResources) {
+		var err error
+		if mapBuildFailure, err = r.mapBuildFailureMessage(ctx, instance); err != nil {
+			return 0, err
+		}
+	}
+
+	instance.Status.SetConditions(childResources, instance.DesiredMapVersion(), mapBuildFailure)
+	instance.Status.SetVolumeResizedCondition(childResources, instance.Spec.Persistence.GetStorage(), volumeExpansionAllowed)
+	instance.Status.SetPhase(childResources, instance.DesiredMapVersion(), isBeingDeleted(instance))
+	instance.Status.SetChildResourceStatus(childResources)
 	err := r.Client.Status().Update(ctx, instance)
 	if err != nil {
 		if errors.IsConflict(err) {
@@ -184,6 +258,9 @@ func (r *ValhallaReconciler) setReconciliationSuccess(
 			Time: time.Now(),
 		},
 	})
+	if conditionStatus == metav1.ConditionFalse {
+		r.Recorder.Event(instance, corev1.EventTypeWarning, reason, msg)
+	}
 	if writerErr := r.Status().Update(ctx, instance); writerErr != nil {
 		ctrl.LoggerFrom(ctx).Error(writerErr, "Failed to update Custom Resource status",
 			"namespace", instance.Namespace,
@@ -191,9 +268,501 @@ func (r *ValhallaReconciler) setReconciliationSuccess(
 	}
 }
 
+// promoteMapVersion switches the workers over to the desired map version once its
+// builder Job has completed. Until then the workers keep serving the previous version.
+func (r *ValhallaReconciler) promoteMapVersion(
+	ctx context.Context,
+	instance *valhallav1alpha1.Valhalla,
+	childResources []runtime.Object,
+) error {
+	desiredMapVersion := instance.DesiredMapVersion()
+	if instance.Status.MapVersion == desiredMapVersion || !isMapBuilderJob(instance, childResources) || !status.IsJobCompleted(childResources) {
+		return nil
+	}
+
+	r.log.Info(fmt.Sprintf("Promoting map version %s on resource: %v/%v", desiredMapVersion, instance.Namespace, instance.Name))
+	report, err := r.mapBuildReport(ctx, instance)
+	if err != nil {
+		// The report is informational, the map is promoted without it.
+		r.log.Error(err, "failed to read map build report")
+	}
+	instance.Status.MapVersion = desiredMapVersion
+	instance.Status.MapSources = instance.Spec.GetPBFURLs()
+	instance.Status.SetMapBuild(childResources, report)
+	instance.Status.SetPhase(childResources, desiredMapVersion, isBeingDeleted(instance))
+	if err := r.Client.Status().Update(ctx, instance); err != nil {
+		return err
+	}
+
+	r.Recorder.Eventf(instance, corev1.EventTypeNormal, "MapBuildCompleted",
+		"Map version %s is built, rolling the workers onto it", desiredMapVersion)
+	return nil
+}
+
+// startMapRefresh records the start of a map refresh in the map-refresh annotation, which yields a new map version.
+// The annotation is patched before any change to the status, since the response of the patch replaces the status in memory.
+func (r *ValhallaReconciler) startMapRefresh(ctx context.Context, instance *valhallav1alpha1.Valhalla, now time.Time) error {
+	if err := r.patchAnnotation(ctx, instance, valhallav1alpha1.MapRefreshAnnotation, now.UTC().Format(time.RFC3339)); err != nil {
+		return err
+	}
+	instance.Status.MapRefreshTime = &metav1.Time{Time: now}
+	return nil
+}
+
+// patchAnnotation sets an annotation of the instance, or removes it when value is empty.
+// The response of the patch replaces the instance in memory, including its status.
+func (r *ValhallaReconciler) patchAnnotation(ctx context.Context, instance *valhallav1alpha1.Valhalla, key, value string) error {
+	patch := client.MergeFrom(instance.DeepCopy())
+	annotations := instance.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	if value == "" {
+		delete(annotations, key)
+	} else {
+		annotations[key] = value
+	}
+	instance.SetAnnotations(annotations)
+	return r.Client.Patch(ctx, instance, patch)
+}
+
+// scheduleMapRefresh starts a map refresh when one is due according to spec.mapRefresh.schedule
+// and returns the time left until the next one. A refresh that falls due while a map build is
+// still in progress is started once that build completes. Refreshes are counted from the most recent
+// refresh, or from the time spec.mapRefresh was enabled if that is later.
+func (r *ValhallaReconciler) scheduleMapRefresh(ctx context.Context, instance *valhallav1alpha1.Valhalla) (time.Duration, error) {
+	if instance.Spec.MapRefresh == nil {
+		// Enabling map refreshes again starts a new schedule.
+		if _, ok := instance.GetAnnotations()[valhallav1alpha1.MapRefreshEnabledAnnotation]; ok {
+			return 0, r.patchAnnotation(ctx, instance, valhallav1alpha1.MapRefreshEnabledAnnotation, "")
+		}
+		return 0, nil
+	}
+	if instance.IsPaused(valhallav1alpha1.MapBuildsPausedAnnotation) {
+		return 0, nil
+	}
+
+	schedule, err := cron.ParseStandard(instance.Spec.MapRefresh.Schedule)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse map refresh schedule: %v", err)
+	}
+
+	now := time.Now()
+	enabledTime, ok := instance.MapRefreshEnabledTime()
+	if !ok {
+		enabledTime = now
+		if err := r.patchAnnotation(ctx, instance, valhallav1alpha1.MapRefreshEnabledAnnotation, now.UTC().Format(time.RFC3339)); err != nil {
+			return 0, err
+		}
+	}
+	lastRefreshTime, ok := instance.LastMapRefreshTime()
+	if !ok || lastRefreshTime.Before(enabledTime) {
+		lastRefreshTime = enabledTime
+	}
+
+	if nextRefreshTime := schedule.Next(lastRefreshTime); nextRefreshTime.After(now) {
+		return nextRefreshTime.Sub(now), nil
+	}
+
+	if instance.Status.MapVersion != instance.DesiredMapVersion() {
+		return 0, nil
+	}
+
+	r.log.Info(fmt.Sprintf("Refreshing map on resource: %v/%v", instance.Namespace, instance.Name))
+	if err := r.startMapRefresh(ctx, instance, now); err != nil {
+		return 0, err
+	}
+	instance.Status.Phase = valhallav1alpha1.PhaseBuildingMap
+	if err := r.Client.Status().Update(ctx, instance); err != nil {
+		return 0, err
+	}
+
+	r.Recorder.Event(instance, corev1.EventTypeNormal, "MapRefreshStarted", "Started a scheduled map refresh")
+	return schedule.Next(now).Sub(now), nil
+}
+
+// updatePausedComponents records the components paused with their pause annotations
+// in status.pausedComponents and records an event whenever a component is paused or resumed.
+func (r *ValhallaReconciler) updatePausedComponents(ctx context.Context, instance *valhallav1alpha1.Valhalla) error {
+	pausedComponents := instance.PausedComponents()
+	if strings.Join(pausedComponents, ",") == strings.Join(instance.Status.PausedComponents, ",") {
+		return nil
+	}
+
+	wasPaused := map[string]bool{}
+	for _, component := range instance.Status.PausedComponents {
+		wasPaused[component] = true
+	}
+	events := []string{}
+	for _, component := range pausedComponents {
+		if !wasPaused[component] {
+			events = append(events, fmt.Sprintf("Paused %s", component))
+		}
+		delete(wasPaused, component)
+	}
+	for _, component := range instance.Status.PausedComponents {
+		if wasPaused[component] {
+			events = append(events, fmt.Sprintf("Resumed %s", component))
+		}
+	}
+
+	if len(pausedComponents) == 0 {
+		pausedComponents = nil
+	}
+	instance.Status.PausedComponents = pausedComponents
+	if err := r.Client.Status().Update(ctx, instance); err != nil {
+		return err
+	}
+	for _, event := range events {
+		r.log.Info(fmt.Sprintf("%s on resource: %v/%v", event, instance.Namespace, instance.Name))
+		r.Recorder.Event(instance, corev1.EventTypeNormal, "ComponentPauseChanged", event)
+	}
+	return nil
+}
+
+// processActions performs the actions requested with action annotations whose value has not been
+// processed yet and acknowledges them in status.actions. Failed map builds are retried by retryMapBuild.
+// It returns the time after which actions that cannot be performed yet are retried.
+func (r *ValhallaReconciler) processActions(ctx context.Context, instance *valhallav1alpha1.Valhalla) (time.Duration, error) {
+	events := []string{}
+	var requeueAfter time.Duration
+
+	// A rebuild is saved in the status together with the acknowledgement of its request before the
+	// annotation the map version is derived from is patched, so that a request starts a single rebuild.
+	// A rebuild whose annotation failed to be patched is completed with the saved time.
+	if refreshTime := instance.Status.MapRefreshTime; refreshTime != nil {
+		if lastRefreshTime, ok := instance.LastMapRefreshTime(); !ok || refreshTime.After(lastRefreshTime) {
+			if err := r.startMapRefresh(ctx, instance, refreshTime.Time); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	// Actions of paused components stay pending until the component is resumed.
+	if value, ok := instance.PendingAction(valhallav1alpha1.RebuildMapAction); ok && !instance.IsPaused(valhallav1alpha1.MapBuildsPausedAnnotation) {
+		instance.Status.MapRefreshTime = &metav1.Time{Time: time.Now()}
+		instance.Status.AcknowledgeAction(valhallav1alpha1.RebuildMapAction, value)
+		if err := r.Client.Status().Update(ctx, instance); err != nil {
+			return 0, err
+		}
+		// The map version is derived from the refresh time, so the rebuild supersedes a build in progress.
+		if err := r.startMapRefresh(ctx, instance, instance.Status.MapRefreshTime.Time); err != nil {
+			return 0, err
+		}
+		instance.Status.Phase = valhallav1alpha1.PhaseBuildingMap
+		events = append(events, "Started a map rebuild")
+	}
+
+	if value, ok := instance.PendingAction(valhallav1alpha1.RestartWorkersAction); ok {
+		instance.Status.WorkersRestartTime = &metav1.Time{Time: time.Now()}
+		instance.Status.AcknowledgeAction(valhallav1alpha1.RestartWorkersAction, value)
+		events = append(events, "Restarting the workers")
+	}
+
+	if value, ok := instance.PendingAction(valhallav1alpha1.RefreshPredictedTrafficAction); ok && !instance.IsPaused(valhallav1alpha1.PredictedTrafficPausedAnnotation) {
+		message, done, err := r.runPredictedTrafficJob(ctx, instance, value)
+		if err != nil {
+			return 0, err
+		}
+		if done {
+			instance.Status.AcknowledgeAction(valhallav1alpha1.RefreshPredictedTrafficAction, value)
+			events = append(events, message)
+		} else {
+			requeueAfter = pendingActionRequeueInterval
+		}
+	}
+
+	if len(events) == 0 {
+		return requeueAfter, nil
+	}
+
+	r.log.Info(fmt.Sprintf("Processing actions on resource: %v/%v", instance.Namespace, instance.Name))
+	if err := r.Client.Status().Update(ctx, instance); err != nil {
+		return 0, err
+	}
+	for _, event := range events {
+		r.Recorder.Event(instance, corev1.EventTypeNormal, "ActionProcessed", event)
+	}
+	return requeueAfter, nil
+}
+
+// runPredictedTrafficJob creates a Job from the predicted traffic CronJob, as kubectl create job --from does.
+// The Job is named after the value of the action annotation, so it is created once per request.
+// It returns whether the request was handled, which it is not until the CronJob exists.
+func (r *ValhallaReconciler) runPredictedTrafficJob(ctx context.Context, instance *valhallav1alpha1.Valhalla, value string) (string, bool, error) {
+	if instance.Spec.PredictedTraffic == nil {
+		return "Skipped the predicted traffic refresh, spec.predictedTraffic is not set", true, nil
+	}
+
+	cronJob := &batchv1.CronJob{}
+	if err := r.Client.Get(ctx, types.NamespacedName{
+		Name:      instance.ChildResourceName(resource.CronJobSuffix),
+		Namespace: instance.Namespace,
+	}, cronJob); err != nil {
+		// The CronJob is created once the map is built, until then the action stays pending.
+		if errors.IsNotFound(err) {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+
+	job, err := r.createPredictedTrafficJob(ctx, cronJob, value)
+	if err != nil {
+		return "", false, err
+	}
+	return fmt.Sprintf("Started predicted traffic Job %s", job.Name), true, nil
+}
+
+// fetchPredictedTrafficForMapVersion runs the predicted traffic Job once for every served map version,
+// since the CronJob fetches the data into the directory of the served version only.
+// It is called with the CronJob as updated for the served version.
+func (r *ValhallaReconciler) fetchPredictedTrafficForMapVersion(
+	ctx context.Context,
+	instance *valhallav1alpha1.Valhalla,
+	cronJob *batchv1.CronJob,
+) error {
+	mapVersion := instance.Status.MapVersion
+	if mapVersion == "" || instance.Status.PredictedTrafficMapVersion == mapVersion ||
+		instance.IsPaused(valhallav1alpha1.PredictedTrafficPausedAnnotation) {
+		return nil
+	}
+
+	job, err := r.createPredictedTrafficJob(ctx, cronJob, "map-"+mapVersion)
+	if err != nil {
+		return err
+	}
+	instance.Status.PredictedTrafficMapVersion = mapVersion
+	if err := r.Client.Status().Update(ctx, instance); err != nil {
+		return err
+	}
+	r.Recorder.Eventf(instance, corev1.EventTypeNormal, "PredictedTrafficFetchStarted",
+		"Started predicted traffic Job %s for map version %s", job.Name, mapVersion)
+	return nil
+}
+
+// createPredictedTrafficJob creates a Job from the predicted traffic CronJob, named after the given value.
+func (r *ValhallaReconciler) createPredictedTrafficJob(ctx context.Context, cronJob *batchv1.CronJob, value string) (*batchv1.Job, error) {
+	hash := sha256.Sum256([]byte(value))
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        fmt.Sprintf("%s-%s", cronJob.Name, hex.EncodeToString(hash[:])[:8]),
+			Namespace:   cronJob.Namespace,
+			Labels:      cronJob.Spec.JobTemplate.Labels,
+			Annotations: map[string]string{"cronjob.kubernetes.io/instantiate": "manual"},
+		},
+		Spec: *cronJob.Spec.JobTemplate.Spec.DeepCopy(),
+	}
+	if err := controllerutil.SetControllerReference(cronJob, job, r.Scheme); err != nil {
+		return nil, err
+	}
+	if err := r.Client.Create(ctx, job); err != nil && !errors.IsAlreadyExists(err) {
+		return nil, err
+	}
+	return job, nil
+}
+
+// deleteStaleMapBuilderJobs removes builder Jobs of map versions that are no longer desired,
+// stopping builds that were superseded by a newer change before they completed.
+func (r *ValhallaReconciler) deleteStaleMapBuilderJobs(ctx context.Context, instance *valhallav1alpha1.Valhalla) error {
+	jobs := &batchv1.JobList{}
+	if err := r.Client.List(ctx, jobs, client.InNamespace(instance.Namespace), client.MatchingLabels{
+		"app": instance.ChildResourceName(resource.JobSuffix),
+	}); err != nil {
+		return err
+	}
+
+	desiredJobName := resource.MapBuilderJobName(instance)
+	for i := range jobs.Items {
+		job := &jobs.Items[i]
+		if job.Name == desiredJobName || !metav1.IsControlledBy(job, instance) {
+			continue
+		}
+		err := r.Client.Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationBackground))
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		r.log.Info(fmt.Sprintf("deleted stale map builder Job %s", job.Name))
+		r.Recorder.Eventf(instance, corev1.EventTypeNormal, "Deleted", "Deleted stale map builder Job %s", job.Name)
+	}
+	return nil
+}
+
+// getWorkerSecrets fetches the Secrets referenced by the worker pods.
+// Secrets that do not exist yet are skipped, the pods cannot start without them anyway.
+// They are read through the APIReader so that the content of Secrets is never cached.
+func (r *ValhallaReconciler) getWorkerSecrets(ctx context.Context, builder *resource.ValhallaResourceBuilder) ([]corev1.Secret, error) {
+	secrets := []corev1.Secret{}
+	for _, name := range builder.Deployment().SecretNames() {
+		secret := corev1.Secret{}
+		err := r.APIReader.Get(ctx, types.NamespacedName{Name: name, Namespace: builder.Instance.Namespace}, &secret)
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		secrets = append(secrets, secret)
+	}
+	return secrets, nil
+}
+
+// findValhallasForSecret maps a Secret to the Valhalla instances whose workers reference it.
+func (r *ValhallaReconciler) findValhallasForSecret(secret client.Object) []reconcile.Request {
+	instances := &valhallav1alpha1.ValhallaList{}
+	if err := r.Client.List(context.Background(), instances, client.InNamespace(secret.GetNamespace())); err != nil {
+		r.log.Error(err, "failed to list Valhalla instances referencing Secret", "secret", secret.GetName())
+		return nil
+	}
+
+	requests := []reconcile.Request{}
+	for i := range instances.Items {
+		builder := &resource.ValhallaResourceBuilder{Instance: &instances.Items[i]}
+		for _, name := range builder.Deployment().SecretNames() {
+			if name == secret.GetName() {
+				requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&instances.Items[i])})
+				break
+			}
+		}
+	}
+	return requests
+}
+
+// pruneResource deletes the object of a builder whose resource is no longer desired,
+// e.g. the predicted traffic CronJob after spec.predictedTraffic has been removed.
+// Objects that are not controlled by the instance are left untouched.
+func (r *ValhallaReconciler) pruneResource(ctx context.Context, instance *valhallav1alpha1.Valhalla, builder resource.ResourceBuilder) error {
+	object, err := builder.Build()
+	if err != nil {
+		return err
+	}
+
+	if err := r.Client.Get(ctx, client.ObjectKeyFromObject(object), object); err != nil {
+		// Optional APIs, such as the Gateway API, may not be installed in the cluster.
+		if meta.IsNoMatchError(err) {
+			return nil
+		}
+		return client.IgnoreNotFound(err)
+	}
+
+	if !metav1.IsControlledBy(object, instance) {
+		return nil
+	}
+
+	err = r.Client.Delete(ctx, object, client.PropagationPolicy(metav1.DeletePropagationBackground))
+	if err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	r.log.Info(fmt.Sprintf("deleted resource %s of Type %T", object.GetName(), object))
+	r.Recorder.Eventf(instance, corev1.EventTypeNormal, "Deleted", "Deleted resource %s of Type %T", object.GetName(), object)
+	return nil
+}
+
+// mapBuildReport returns the report the map builder writes to its termination log once the
+// build completes, or nil if there is none, e.g. because the builder pod was already removed.
+// The pods are listed through the APIReader, which avoids caching every Pod of the cluster.
+func (r *ValhallaReconciler) mapBuildReport(ctx context.Context, instance *valhallav1alpha1.Valhalla) (*status.MapBuildReport, error) {
+	pods := &corev1.PodList{}
+	if err := r.APIReader.List(ctx, pods, client.InNamespace(instance.Namespace), client.MatchingLabels{
+		"job-name": resource.MapBuilderJobName(instance),
+	}); err != nil {
+		return nil, err
+	}
+
+	for _, pod := range pods.Items {
+		for _, containerStatus := range pod.Status.ContainerStatuses {
+			if terminated := containerStatus.State.Terminated; terminated != nil && terminated.ExitCode == 0 && terminated.Message != "" {
+				return status.ParseMapBuildReport(terminated.Message)
+			}
+		}
+	}
+	return nil, nil
+}
+
+// mapBuildFailureMessage returns the tail of the termination messages of the failed map builder,
+// which explains why the build failed, e.g. a checksum mismatch of a PBF extract.
+// Like mapBuildReport, the pods are listed through the APIReader.
+func (r *ValhallaReconciler) mapBuildFailureMessage(ctx context.Context, instance *valhallav1alpha1.Valhalla) (string, error) {
+	pods := &corev1.PodList{}
+	if err := r.APIReader.List(ctx, pods, client.InNamespace(instance.Namespace), client.MatchingLabels{
+		"job-name": resource.MapBuilderJobName(instance),
+	}); err != nil {
+		return "", err
+	}
+	return status.TerminationMessageTail(pods.Items), nil
+}
+
+// retryMapBuild deletes the failed builder Job so that it is re-created, once the backoff of
+// spec.builder.retryPolicy has passed or when a retry is requested with the retry-map-build action.
+// It returns whether the build was retried and otherwise the time left until the next retry.
+func (r *ValhallaReconciler) retryMapBuild(
+	ctx context.Context,
+	instance *valhallav1alpha1.Valhalla,
+	childResources []runtime.Object,
+) (bool, time.Duration, error) {
+	if instance.IsPaused(valhallav1alpha1.MapBuildsPausedAnnotation) {
+		return false, 0, nil
+	}
+
+	desiredMapVersion := instance.DesiredMapVersion()
+	retryStatus := &valhallav1alpha1.MapBuildRetryStatus{
+		MapVersion: desiredMapVersion,
+		Retries:    instance.Status.MapBuildRetries(desiredMapVersion),
+	}
+	if instance.Status.MapBuildRetry != nil && retryStatus.MapVersion == instance.Status.MapBuildRetry.MapVersion {
+		retryStatus.LastRetryTime = instance.Status.MapBuildRetry.LastRetryTime
+	}
+
+	manualRetry, manualRetryRequested := instance.PendingAction(valhallav1alpha1.RetryMapBuildAction)
+	jobFailedCondition := status.JobFailedCondition(childResources)
+
+	switch {
+	case jobFailedCondition == nil && !manualRetryRequested:
+		return false, 0, nil
+	case jobFailedCondition == nil:
+		// There is no failed build to retry. The request is acknowledged anyway, so that it does not retry a later failure.
+		instance.Status.AcknowledgeAction(valhallav1alpha1.RetryMapBuildAction, manualRetry)
+		return false, 0, r.Client.Status().Update(ctx, instance)
+	case manualRetryRequested:
+		instance.Status.AcknowledgeAction(valhallav1alpha1.RetryMapBuildAction, manualRetry)
+	default:
+		retryPolicy := instance.Spec.GetBuilder().RetryPolicy
+		if retryPolicy == nil || retryStatus.Retries >= retryPolicy.GetMaxRetries() {
+			return false, 0, nil
+		}
+		retryTime := jobFailedCondition.LastTransitionTime.Add(retryPolicy.GetBackoff(retryStatus.Retries))
+		if now := time.Now(); retryTime.After(now) {
+			return false, retryTime.Sub(now), nil
+		}
+	}
+
+	r.log.Info(fmt.Sprintf("Retrying map build on resource: %v/%v", instance.Namespace, instance.Name))
+	retryStatus.Retries++
+	retryStatus.LastRetryTime = &metav1.Time{Time: time.Now()}
+	instance.Status.MapBuildRetry = retryStatus
+	instance.Status.Phase = valhallav1alpha1.PhaseBuildingMap
+	// The retry is recorded before the Job is deleted, so that a failing status update cannot lead to unbounded retries.
+	if err := r.Client.Status().Update(ctx, instance); err != nil {
+		return false, 0, err
+	}
+
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      resource.MapBuilderJobName(instance),
+			Namespace: instance.Namespace,
+		},
+	}
+	if err := r.Client.Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil && !errors.IsNotFound(err) {
+		return false, 0, err
+	}
+
+	r.Recorder.Eventf(instance, corev1.EventTypeNormal, "MapBuildRetried",
+		"Retrying the build of map version %s (retry %d)", desiredMapVersion, retryStatus.Retries)
+	return true, 0, nil
+}
+
 // logAndRecordOperationResult - helper function to log and record events with message and error
 // it logs and records 'updated' and 'created' OperationResult, and ignores OperationResult 'unchanged'
-func (r *ValhallaReconciler) logOperationResult(
+func (r *ValhallaReconciler) logAndRecordOperationResult(
 	logger logr.Logger,
 	ro runtime.Object,
 	resource runtime.Object,
@@ -204,29 +773,38 @@ func (r *ValhallaReconciler) logOperationResult(
 		return
 	}
 
-	var operation string
+	var operation, reason string
 	if operationResult == controllerutil.OperationResultCreated {
 		operation = "create"
+		reason = "Create"
 	}
 
 	if operationResult == controllerutil.OperationResultUpdated {
 		operation = "update"
+		reason = "Update"
 	}
 
 	if err == nil {
 		msg := fmt.Sprintf("%sd resource %s of Type %T", operation, resource.(metav1.Object).GetName(), resource.(metav1.Object))
 		logger.Info(msg)
+		r.Recorder.Event(ro, corev1.EventTypeNormal, "Successful"+reason, msg)
 	}
 
 	if err != nil {
 		msg := fmt.Sprintf("failed to %s resource %s of Type %T", operation, resource.(metav1.Object).GetName(), resource.(metav1.Object))
 		logger.Error(err, msg)
+		r.Recorder.Event(ro, corev1.EventTypeWarning, "Failed"+reason, msg)
 	}
 }
 
-func (r *ValhallaReconciler) cleanup(ctx context.Context, instance *valhallav1alpha1.Valhalla) error {
+// cleanup releases the volume of a deleted instance and removes its finalizer. It returns the time
+// after which it is retried while the volume cannot be released yet, e.g. while it is being snapshotted.
+func (r *ValhallaReconciler) cleanup(ctx context.Context, instance *valhallav1alpha1.Valhalla) (time.Duration, error) {
 	if controllerutil.ContainsFinalizer(instance, finalizerName) {
+		// The cleanup is repeated while the volume is being released, but only recorded once.
+		cleanupStarted := instance.Status.Phase == valhallav1alpha1.PhaseDeleting
 		instance.Status.ObservedGeneration = instance.Generation
+		instance.Status.Phase = valhallav1alpha1.PhaseDeleting
 		instance.Status.SetCondition(metav1.Condition{
 			Type:    status.ConditionAvailable,
 			Status:  metav1.ConditionFalse,
@@ -236,14 +814,25 @@ func (r *ValhallaReconciler) cleanup(ctx context.Context, instance *valhallav1al
 
 		err := r.Client.Status().Update(ctx, instance)
 		if err != nil {
-			return err
+			return 0, err
+		}
+		if !cleanupStarted {
+			r.Recorder.Event(instance, corev1.EventTypeNormal, "Cleanup", "Deleting Valhalla resources")
+		}
+
+		released, err := r.releaseVolume(ctx, instance)
+		if err != nil {
+			return 0, err
+		}
+		if !released {
+			return volumeReleaseRequeueInterval, nil
 		}
 
 		controllerutil.RemoveFinalizer(instance, finalizerName)
 
 		err = r.Client.Update(ctx, instance)
 		if err != nil {
-			return err
+			return 0, err
 		}
 	}
 
@@ -252,9 +841,149 @@ func (r *ValhallaReconciler) cleanup(ctx context.Context, instance *valhallav1al
 	if errors.IsConflict(err) || errors.IsNotFound(err) {
 		// These errors are ignored. They can happen if the CR was removed
 		// before the status update call is executed.
+		return 0, nil
+	}
+	return 0, err
+}
+
+// releaseVolume prepares the PersistentVolumeClaim of a deleted instance according to spec.persistence.
+// A snapshot is taken if requested, and with the Retain reclaim policy the claim is orphaned, so that
+// the garbage collector keeps it, and labelled for adoption by a new instance of the same name.
+// It returns whether the claim is released, which it is not until the snapshot has been taken,
+// since the garbage collector deletes the claim once the finalizer is removed.
+func (r *ValhallaReconciler) releaseVolume(ctx context.Context, instance *valhallav1alpha1.Valhalla) (bool, error) {
+	pvc := &corev1.PersistentVolumeClaim{}
+	if err := r.Client.Get(ctx, types.NamespacedName{
+		Name:      instance.ChildResourceName(resource.PersistentVolumeClaimSuffix),
+		Namespace: instance.Namespace,
+	}, pvc); err != nil {
+		return true, client.IgnoreNotFound(err)
+	}
+	if !metav1.IsControlledBy(pvc, instance) {
+		return true, nil
+	}
+
+	if instance.Spec.Persistence.SnapshotBeforeDeletion != nil {
+		if snapshotted, err := r.snapshotVolume(ctx, instance, pvc); !snapshotted || err != nil {
+			return false, err
+		}
+	}
+
+	if instance.Spec.Persistence.GetReclaimPolicy() != valhallav1alpha1.ReclaimPolicyRetain {
+		return true, nil
+	}
+
+	ownerReferences := []metav1.OwnerReference{}
+	for _, ownerReference := range pvc.OwnerReferences {
+		if ownerReference.UID != instance.UID {
+			ownerReferences = append(ownerReferences, ownerReference)
+		}
+	}
+	pvc.OwnerReferences = ownerReferences
+	if pvc.Labels == nil {
+		pvc.Labels = map[string]string{}
+	}
+	pvc.Labels[resource.RetainedLabel] = instance.Name
+	if pvc.Annotations == nil {
+		pvc.Annotations = map[string]string{}
+	}
+	pvc.Annotations[resource.MapVersionAnnotation] = instance.Status.MapVersion
+	// The inputs of the served map are recorded, since its version also depends on the map refresh.
+	// They are only known when the served map is the desired version.
+	delete(pvc.Annotations, resource.MapSourcesHashAnnotation)
+	delete(pvc.Annotations, valhallav1alpha1.MapRefreshAnnotation)
+	if instance.Status.MapVersion != "" && instance.Status.MapVersion == instance.DesiredMapVersion() {
+		pvc.Annotations[resource.MapSourcesHashAnnotation] = instance.MapSourcesHash()
+		if refresh := instance.GetAnnotations()[valhallav1alpha1.MapRefreshAnnotation]; refresh != "" {
+			pvc.Annotations[valhallav1alpha1.MapRefreshAnnotation] = refresh
+		}
+	}
+	if err := r.Client.Update(ctx, pvc); err != nil {
+		return false, err
+	}
+	r.Recorder.Eventf(instance, corev1.EventTypeNormal, "VolumeRetained", "Retained PersistentVolumeClaim %s", pvc.Name)
+	return true, nil
+}
+
+// snapshotVolume creates a VolumeSnapshot of the PersistentVolumeClaim and reports whether it is ready.
+// The claim is released without a snapshot when VolumeSnapshots are not available in the cluster,
+// since the deletion of the instance would be blocked otherwise.
+func (r *ValhallaReconciler) snapshotVolume(
+	ctx context.Context,
+	instance *valhallav1alpha1.Valhalla,
+	pvc *corev1.PersistentVolumeClaim,
+) (bool, error) {
+	snapshot := resource.VolumeSnapshot(instance)
+	if err := r.Client.Create(ctx, snapshot); err == nil {
+		r.Recorder.Eventf(instance, corev1.EventTypeNormal, "VolumeSnapshotCreated",
+			"Created VolumeSnapshot %s of PersistentVolumeClaim %s", snapshot.GetName(), pvc.Name)
+	} else if meta.IsNoMatchError(err) {
+		r.Recorder.Eventf(instance, corev1.EventTypeWarning, "VolumeSnapshotUnavailable",
+			"Released PersistentVolumeClaim %s without a snapshot, VolumeSnapshots are not available in the cluster", pvc.Name)
+		return true, nil
+	} else if !errors.IsAlreadyExists(err) {
+		return false, fmt.Errorf("failed to snapshot PersistentVolumeClaim %s: %v", pvc.Name, err)
+	}
+
+	// The snapshot is read through the APIReader, so that no informer is started for VolumeSnapshots.
+	if err := r.APIReader.Get(ctx, client.ObjectKeyFromObject(snapshot), snapshot); err != nil {
+		return false, err
+	}
+	if !resource.IsVolumeSnapshotReady(snapshot) {
+		r.log.Info(fmt.Sprintf("Waiting for VolumeSnapshot %s of PersistentVolumeClaim %s", snapshot.GetName(), pvc.Name))
+		return false, nil
+	}
+	return true, nil
+}
+
+// adoptRetainedVolume takes over the map served by a deleted instance of the same name, whose
+// PersistentVolumeClaim was retained. The map is only taken over when it was built from the PBF sources
+// of the instance, otherwise the desired version is built into the adopted claim. The map refresh of the
+// deleted instance is taken over along with the map, unless the instance has started a refresh of its own.
+func (r *ValhallaReconciler) adoptRetainedVolume(
+	ctx context.Context,
+	instance *valhallav1alpha1.Valhalla,
+	childResources []runtime.Object,
+) error {
+	if instance.Status.MapVersion != "" {
+		return nil
+	}
+
+	for _, object := range childResources {
+		pvc, ok := object.(*corev1.PersistentVolumeClaim)
+		if !ok || pvc == nil {
+			continue
+		}
+		if pvc.Labels[resource.RetainedLabel] != instance.Name || metav1.GetControllerOf(pvc) != nil ||
+			pvc.Annotations[resource.MapSourcesHashAnnotation] != instance.MapSourcesHash() {
+			return nil
+		}
+
+		refresh := pvc.Annotations[valhallav1alpha1.MapRefreshAnnotation]
+		if _, ok := instance.GetAnnotations()[valhallav1alpha1.MapRefreshAnnotation]; !ok && refresh != "" {
+			// The annotation is patched before any change to the status, since the response of the patch replaces the status in memory.
+			if err := r.patchAnnotation(ctx, instance, valhallav1alpha1.MapRefreshAnnotation, refresh); err != nil {
+				return err
+			}
+		}
+		if pvc.Annotations[resource.MapVersionAnnotation] != instance.DesiredMapVersion() {
+			return nil
+		}
+
+		r.log.Info(fmt.Sprintf("Adopting retained map on resource: %v/%v", instance.Namespace, instance.Name))
+		instance.Status.MapVersion = instance.DesiredMapVersion()
+		instance.Status.MapSources = instance.Spec.GetPBFURLs()
+		if refreshTime, ok := instance.LastMapRefreshTime(); ok {
+			instance.Status.MapRefreshTime = &metav1.Time{Time: refreshTime}
+		}
+		if err := r.Client.Status().Update(ctx, instance); err != nil {
+			return err
+		}
+		r.Recorder.Eventf(instance, corev1.EventTypeNormal, "VolumeAdopted",
+			"Adopted PersistentVolumeClaim %s serving map version %s", pvc.Name, instance.Status.MapVersion)
 		return nil
 	}
-	return err
+	return nil
 }
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
@@ -290,8 +1019,19 @@ func (r *ValhallaReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 		return ctrl.Result{}, err
 	}
 
-	if requeueAfter, err := r.updateValhallaStatusConditions(ctx, instance, childResources); err != nil || requeueAfter > 0 {
-		return ctrl.Result{RequeueAfter: requeueAfter}, err
+	volumeExpansionAllowed, err := r.isVolumeExpansionAllowed(ctx, childResources)
+	if err != nil {
+		logger.Error(err, "Failed to fetch StorageClass")
+		r.setReconciliationSuccess(ctx, instance, metav1.ConditionFalse, "FailedToFetchStorageClass", err.Error())
+		return ctrl.Result{}, err
+	}
+
+	// The status of an instance that is being deleted is maintained by cleanup, which records
+	// the Cleanup event only when it first sets the Deleting phase.
+	if !isBeingDeleted(instance) {
+		if requeueAfter, err := r.updateValhallaStatusConditions(ctx, instance, childResources, volumeExpansionAllowed); err != nil || requeueAfter > 0 {
+			return ctrl.Result{RequeueAfter: requeueAfter}, err
+		}
 	}
 
 	if !isInitialized(instance) {
@@ -303,25 +1043,45 @@ func (r *ValhallaReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 	}
 
 	if isBeingDeleted(instance) {
-		err := r.cleanup(ctx, instance)
+		requeueAfter, err := r.cleanup(ctx, instance)
 		if err != nil {
 			logger.Error(err, "Cleanup failed for rerouce: %v/%v", instance.Namespace, instance.Name)
 			return ctrl.Result{}, err
 		}
 
-		return ctrl.Result{}, nil
+		return ctrl.Result{RequeueAfter: requeueAfter}, nil
 	}
 
-	if isPaused(instance) {
+	if instance.IsPaused(valhallav1alpha1.OperatorPausedAnnotation) {
 		if instance.Status.Paused {
-			logger.Info("Valhalla operator is paused on resource: %v/%v", instance.Namespace, instance.Name)
+			logger.Info(fmt.Sprintf("Valhalla operator is paused on resource: %v/%v", instance.Namespace, instance.Name))
 			return ctrl.Result{}, nil
 		}
 		logger.Info(fmt.Sprintf("Pausing Valhalla operator on resource: %v/%v", instance.Namespace, instance.Name))
+		// Only the status is written, an update of the whole resource would overwrite it with the stored status.
 		instance.Status.Paused = true
-		err := r.updateValhallaResource(ctx, instance)
-		// instance.Status.ObservedGeneration = instance.Generation
-		// err := r.Client.Status().Update(ctx, instance)
+		instance.Status.ObservedGeneration = instance.Generation
+		err := r.Client.Status().Update(ctx, instance)
+		if err == nil {
+			r.Recorder.Event(instance, corev1.EventTypeNormal, "Paused", "Reconciliation is paused")
+		}
+		return ctrl.Result{}, err
+	}
+
+	if instance.Status.Paused {
+		logger.Info(fmt.Sprintf("Unpausing Valhalla operator on resource: %v/%v", instance.Namespace, instance.Name))
+		instance.Status.Paused = false
+		if err := r.Client.Status().Update(ctx, instance); err != nil {
+			return ctrl.Result{}, err
+		}
+		r.Recorder.Event(instance, corev1.EventTypeNormal, "Unpaused", "Reconciliation is resumed")
+	}
+
+	if err := r.updatePausedComponents(ctx, instance); err != nil {
+		if errors.IsConflict(err) {
+			logger.Info("failed to record paused components because of conflict; requeueing...")
+			return ctrl.Result{RequeueAfter: 2 * time.Second}, nil
+		}
 		return ctrl.Result{}, err
 	}
 
@@ -332,9 +1092,100 @@ func (r *ValhallaReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 
 	logger.Info("Reconciling Valhalla instance", "spec", string(rawInstanceSpec))
 
+	if err := r.adoptRetainedVolume(ctx, instance, childResources); err != nil {
+		if errors.IsConflict(err) {
+			logger.Info("failed to adopt retained volume because of conflict; requeueing...")
+			return ctrl.Result{RequeueAfter: 2 * time.Second}, nil
+		}
+		logger.Error(err, "Failed to adopt retained volume")
+		r.setReconciliationSuccess(ctx, instance, metav1.ConditionFalse, "FailedToAdoptVolume", err.Error())
+		return ctrl.Result{}, err
+	}
+
+	// The map version is promoted before actions and refreshes change the desired version,
+	// since the child resources were fetched for the current one.
+	if err := r.promoteMapVersion(ctx, instance, childResources); err != nil {
+		if errors.IsConflict(err) {
+			logger.Info("failed to promote map version because of conflict; requeueing...")
+			return ctrl.Result{RequeueAfter: 2 * time.Second}, nil
+		}
+		logger.Error(err, "Failed to promote map version")
+		r.setReconciliationSuccess(ctx, instance, metav1.ConditionFalse, "FailedToPromoteMapVersion", err.Error())
+		return ctrl.Result{}, err
+	}
+
+	desiredMapVersion := instance.DesiredMapVersion()
+	actionsRequeueAfter, err := r.processActions(ctx, instance)
+	if err != nil {
+		if errors.IsConflict(err) {
+			logger.Info("failed to process actions because of conflict; requeueing...")
+			return ctrl.Result{RequeueAfter: 2 * time.Second}, nil
+		}
+		logger.Error(err, "Failed to process actions")
+		r.setReconciliationSuccess(ctx, instance, metav1.ConditionFalse, "FailedToProcessActions", err.Error())
+		return ctrl.Result{}, err
+	}
+
+	requeueAfter, err := r.scheduleMapRefresh(ctx, instance)
+	if err != nil {
+		if errors.IsConflict(err) {
+			logger.Info("failed to schedule map refresh because of conflict; requeueing...")
+			return ctrl.Result{RequeueAfter: 2 * time.Second}, nil
+		}
+		logger.Error(err, "Failed to schedule map refresh")
+		r.setReconciliationSuccess(ctx, instance, metav1.ConditionFalse, "FailedToScheduleMapRefresh", err.Error())
+		return ctrl.Result{}, err
+	}
+	requeueAfter = shortestRequeue(requeueAfter, actionsRequeueAfter)
+
+	if instance.DesiredMapVersion() != desiredMapVersion {
+		// The child resources, e.g. the builder Job, belong to the previous map version.
+		logger.Info("Desired map version changed; requeueing...")
+		return ctrl.Result{Requeue: true}, nil
+	}
+
+	if err := r.deleteStaleMapBuilderJobs(ctx, instance); err != nil {
+		logger.Error(err, "Failed to delete stale map builder Jobs")
+		r.setReconciliationSuccess(ctx, instance, metav1.ConditionFalse, "FailedToDeleteStaleJobs", err.Error())
+		return ctrl.Result{}, err
+	}
+
+	retried, retryAfter, err := r.retryMapBuild(ctx, instance, childResources)
+	if err != nil {
+		if errors.IsConflict(err) {
+			logger.Info("failed to retry map build because of conflict; requeueing...")
+			return ctrl.Result{RequeueAfter: 2 * time.Second}, nil
+		}
+		logger.Error(err, "Failed to retry map build")
+		r.setReconciliationSuccess(ctx, instance, metav1.ConditionFalse, "FailedToRetryMapBuild", err.Error())
+		return ctrl.Result{}, err
+	}
+	if retried {
+		// The builder Job is re-created once its deletion triggers the next reconciliation.
+		return ctrl.Result{}, nil
+	}
+	requeueAfter = shortestRequeue(requeueAfter, retryAfter)
+
 	resourceBuilder := resource.ValhallaResourceBuilder{
-		Instance: instance,
-		Scheme:   r.Scheme,
+		Instance:               instance,
+		Scheme:                 r.Scheme,
+		VolumeExpansionAllowed: volumeExpansionAllowed,
+	}
+
+	scalingWindow, scalingRequeueAfter, err := resource.ActiveScalingWindow(instance.Spec.ScalingSchedule, time.Now())
+	if err != nil {
+		logger.Error(err, "Failed to evaluate scaling schedule")
+		r.setReconciliationSuccess(ctx, instance, metav1.ConditionFalse, "InvalidScalingSchedule", err.Error())
+		return ctrl.Result{}, err
+	}
+	resourceBuilder.ScalingWindow = scalingWindow
+	requeueAfter = shortestRequeue(requeueAfter, scalingRequeueAfter)
+
+	resourceBuilder.Secrets, err = r.getWorkerSecrets(ctx, &resourceBuilder)
+	if err != nil {
+		logger.Error(err, "Failed to fetch Secrets referenced by the workers")
+		r.setReconciliationSuccess(ctx, instance, metav1.ConditionFalse, "FailedToFetchSecrets", err.Error())
+		return ctrl.Result{}, err
 	}
 
 	builders := resourceBuilder.ResourceBuilders()
@@ -356,17 +1207,63 @@ func (r *ValhallaReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 				})
 				return apiError
 			})
-			r.logOperationResult(logger, instance, resource, operationResult, err)
+			r.logAndRecordOperationResult(logger, instance, resource, operationResult, err)
+			if _, ok := resource.(*batchv1.Job); ok && operationResult == controllerutil.OperationResultCreated {
+				r.Recorder.Eventf(instance, corev1.EventTypeNormal, "MapBuildStarted",
+					"Started building map version %s", instance.DesiredMapVersion())
+			}
 			if err != nil {
 				r.setReconciliationSuccess(ctx, instance, metav1.ConditionFalse, "Error", err.Error())
 				return ctrl.Result{}, err
 			}
+			if cronJob, ok := resource.(*batchv1.CronJob); ok {
+				if err := r.fetchPredictedTrafficForMapVersion(ctx, instance, cronJob); err != nil {
+					logger.Error(err, "Failed to fetch predicted traffic for the served map version")
+					r.setReconciliationSuccess(ctx, instance, metav1.ConditionFalse, "FailedToFetchPredictedTraffic", err.Error())
+					return ctrl.Result{}, err
+				}
+			}
+		} else if pruner, ok := builder.(resource.ResourcePruner); ok && pruner.ShouldPrune(childResources) {
+			if err := r.pruneResource(ctx, instance, builder); err != nil {
+				logger.Error(err, "Failed to delete resource that is no longer desired")
+				r.setReconciliationSuccess(ctx, instance, metav1.ConditionFalse, "FailedToDeleteChildResource", err.Error())
+				return ctrl.Result{}, err
+			}
 		}
 	}
 
+	if status.IsJobFailed(childResources) {
+		msg := "Map builder Job failed"
+		if condition := meta.FindStatusCondition(instance.Status.Conditions, status.ConditionMapBuilt); condition != nil {
+			msg = condition.Message
+		}
+		logger.Info(fmt.Sprintf("Map build failed on resource %v/%v: %s", instance.Namespace, instance.Name, msg))
+		r.setReconciliationSuccess(ctx, instance, metav1.ConditionFalse, "MapBuildFailed", msg)
+		return ctrl.Result{RequeueAfter: requeueAfter}, nil
+	}
+
 	r.setReconciliationSuccess(ctx, instance, metav1.ConditionTrue, "Success", "Finished reconciling")
 	logger.Info("Finished reconciling")
-	return ctrl.Result{}, nil
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
+}
+
+// isMapBuilderJob reports whether the Job among the child resources builds the desired map version.
+// It does not when the desired version changed after the child resources were fetched.
+func isMapBuilderJob(instance *valhallav1alpha1.Valhalla, childResources []runtime.Object) bool {
+	for _, childResource := range childResources {
+		if job, ok := childResource.(*batchv1.Job); ok && job != nil {
+			return job.Name == resource.MapBuilderJobName(instance)
+		}
+	}
+	return false
+}
+
+// shortestRequeue returns the shorter of two requeue durations, where 0 means no requeue.
+func shortestRequeue(a, b time.Duration) time.Duration {
+	if a == 0 || (b > 0 && b < a) {
+		return b
+	}
+	return a
 }
 
 func isInitialized(instance *valhallav1alpha1.Valhalla) bool {
@@ -377,31 +1274,33 @@ func isBeingDeleted(object metav1.Object) bool {
 	return !object.GetDeletionTimestamp().IsZero()
 }
 
-func isPaused(object metav1.Object) bool {
-	if object.GetAnnotations() == nil {
-		return false
-	}
-	pausedStr, ok := object.GetAnnotations()[valhallav1alpha1.OperatorPausedAnnotation]
-	if !ok {
-		return false
-	}
-	paused, err := strconv.ParseBool(pausedStr)
-	if err != nil {
-		return false
-	}
-	return paused
-}
-
 // SetupWithManager sets up the controller with the Manager.
 func (r *ValhallaReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
+	controllerBuilder := ctrl.NewControllerManagedBy(mgr).
 		For(&valhallav1alpha1.Valhalla{}).
 		Owns(&corev1.PersistentVolumeClaim{}).
 		Owns(&batchv1.Job{}).
 		Owns(&batchv1.CronJob{}).
 		Owns(&appsv1.Deployment{}).
 		Owns(&corev1.Service{}).
-		Owns(&autoscalingv1.HorizontalPodAutoscaler{}).
+		Owns(&corev1.ConfigMap{}).
+		Owns(&networkingv1.Ingress{}).
+		Owns(&networkingv1.NetworkPolicy{}).
+		Owns(&autoscalingv2.HorizontalPodAutoscaler{}).
 		Owns(&policyv1.PodDisruptionBudget{}).
-		Complete(r)
+		// Only the metadata of Secrets is watched, their content is read on demand by getWorkerSecrets.
+		Watches(&source.Kind{Type: &corev1.Secret{}}, handler.EnqueueRequestsFromMapFunc(r.findValhallasForSecret), builder.OnlyMetadata)
+
+	// HTTPRoutes are only watched when the Gateway API CRDs are installed, a watch on a missing kind
+	// would prevent the controller from starting.
+	httpRouteGVK := resource.HTTPRouteGroupVersionKind
+	if _, err := mgr.GetRESTMapper().RESTMapping(httpRouteGVK.GroupKind(), httpRouteGVK.Version); err == nil {
+		httpRoute := &unstructured.Unstructured{}
+		httpRoute.SetGroupVersionKind(httpRouteGVK)
+		controllerBuilder = controllerBuilder.Owns(httpRoute)
+	} else if !meta.IsNoMatchError(err) {
+		return err
+	}
+
+	return controllerBuilder.Complete(r)
 }
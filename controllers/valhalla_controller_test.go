@@ -6,17 +6,27 @@ import (
 	"time"
 
 	valhallav1alpha1 "github.com/itayankri/valhalla-operator/api/v1alpha1"
+	"github.com/itayankri/valhalla-operator/controllers"
+	valhallaresource "github.com/itayankri/valhalla-operator/internal/resource"
 	"github.com/itayankri/valhalla-operator/internal/status"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	appsv1 "k8s.io/api/apps/v1"
-	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/utils/pointer"
+	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
 
 const (
@@ -184,6 +194,377 @@ var _ = Describe("ValhallaController", func() {
 		})
 	})
 
+	Context("Valhalla CR phase", func() {
+		BeforeEach(func() {
+			instance = generateValhallaCluster("phase")
+			Expect(k8sClient.Create(ctx, instance)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(k8sClient.Delete(ctx, instance)).To(Succeed())
+		})
+
+		It("Should report the WorkersDeployed phase once the workers are deployed", func() {
+			waitForValhallaDeployment(ctx, instance, k8sClient)
+			Eventually(func() valhallav1alpha1.Phase {
+				valhalla := &valhallav1alpha1.Valhalla{}
+				Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(instance), valhalla)).To(Succeed())
+				return valhalla.Status.Phase
+			}, 60*time.Second).Should(Equal(valhallav1alpha1.PhaseWorkersDeployed))
+		})
+	})
+
+	Context("Prune child resources", func() {
+		BeforeEach(func() {
+			instance = generateValhallaCluster("prune-children")
+			instance.Spec.PredictedTraffic = &valhallav1alpha1.PredictedTrafficSpec{
+				URL:      "https://example.com/traffic.tar",
+				Schedule: "0 * * * *",
+			}
+			Expect(k8sClient.Create(ctx, instance)).To(Succeed())
+			waitForValhallaDeployment(ctx, instance, k8sClient)
+		})
+
+		AfterEach(func() {
+			Expect(k8sClient.Delete(ctx, instance)).To(Succeed())
+		})
+
+		It("Should delete the predicted traffic CronJob when it is removed from the spec", func() {
+			cronJobKey := types.NamespacedName{
+				Name:      instance.ChildResourceName("predicted-traffic"),
+				Namespace: instance.Namespace,
+			}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, cronJobKey, &batchv1.CronJob{})
+			}, MapBuildingTimeout).Should(Succeed())
+
+			Expect(updateWithRetry(instance, func(v *valhallav1alpha1.Valhalla) {
+				v.Spec.PredictedTraffic = nil
+			})).To(Succeed())
+
+			Eventually(func() bool {
+				return errors.IsNotFound(k8sClient.Get(ctx, cronJobKey, &batchv1.CronJob{}))
+			}, 10*time.Second).Should(BeTrue())
+		})
+	})
+
+	Context("Predicted traffic", func() {
+		BeforeEach(func() {
+			instance = generateValhallaCluster("predicted-traffic")
+			instance.Spec.PredictedTraffic = &valhallav1alpha1.PredictedTrafficSpec{
+				URL:      "https://example.com/traffic.tar",
+				Schedule: "0 0 1 1 *",
+			}
+			Expect(k8sClient.Create(ctx, instance)).To(Succeed())
+			waitForValhallaDeployment(ctx, instance, k8sClient)
+		})
+
+		AfterEach(func() {
+			Expect(k8sClient.Delete(ctx, instance)).To(Succeed())
+		})
+
+		It("Should fetch the predicted traffic into every served map version", func() {
+			valhalla := &valhallav1alpha1.Valhalla{}
+			Eventually(func() string {
+				Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(instance), valhalla)).To(Succeed())
+				return valhalla.Status.PredictedTrafficMapVersion
+			}, 10*time.Second).Should(Equal(valhalla.Status.MapVersion))
+			builtMapVersion := valhalla.Status.MapVersion
+
+			Expect(updateWithRetry(instance, func(v *valhallav1alpha1.Valhalla) {
+				v.Annotations = map[string]string{valhallav1alpha1.ActionAnnotationPrefix + valhallav1alpha1.RebuildMapAction: "1"}
+			})).To(Succeed())
+
+			Eventually(func() string {
+				Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(instance), valhalla)).To(Succeed())
+				return valhalla.Status.PredictedTrafficMapVersion
+			}, MapBuildingTimeout).ShouldNot(Equal(builtMapVersion))
+			Expect(valhalla.Status.PredictedTrafficMapVersion).To(Equal(valhalla.Status.MapVersion))
+
+			jobs := &batchv1.JobList{}
+			Expect(k8sClient.List(ctx, jobs, client.InNamespace(instance.Namespace))).To(Succeed())
+			trafficJobs := 0
+			for _, job := range jobs.Items {
+				if owner := metav1.GetControllerOf(&job); owner != nil && owner.Kind == "CronJob" && owner.Name == instance.ChildResourceName("predicted-traffic") {
+					trafficJobs++
+				}
+			}
+			Expect(trafficJobs).To(Equal(2))
+		})
+	})
+
+	Context("Fixed replicas", func() {
+		BeforeEach(func() {
+			instance = generateValhallaCluster("fixed-replicas")
+			Expect(k8sClient.Create(ctx, instance)).To(Succeed())
+			waitForValhallaDeployment(ctx, instance, k8sClient)
+		})
+
+		AfterEach(func() {
+			Expect(k8sClient.Delete(ctx, instance)).To(Succeed())
+		})
+
+		It("Should delete the HorizontalPodAutoscaler when a fixed number of replicas is set", func() {
+			hpa(ctx, instance, "")
+			replicas := int32(2)
+			Expect(updateWithRetry(instance, func(v *valhallav1alpha1.Valhalla) {
+				v.Spec.Replicas = &replicas
+			})).To(Succeed())
+
+			Eventually(func() bool {
+				err := k8sClient.Get(ctx, client.ObjectKeyFromObject(instance), &autoscalingv2.HorizontalPodAutoscaler{})
+				return errors.IsNotFound(err)
+			}, 10*time.Second).Should(BeTrue())
+
+			Eventually(func() int32 {
+				return *deployment(ctx, instance, "").Spec.Replicas
+			}, 10*time.Second).Should(Equal(replicas))
+		})
+	})
+
+	Context("Map build failure", func() {
+		BeforeEach(func() {
+			instance = generateValhallaCluster("map-build-failure")
+			instance.Spec.PBFURL = "https://example.com/does-not-exist.osm.pbf"
+			instance.Spec.Builder = &valhallav1alpha1.BuilderSpec{BackoffLimit: pointer.Int32Ptr(0)}
+			Expect(k8sClient.Create(ctx, instance)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(k8sClient.Delete(ctx, instance)).To(Succeed())
+		})
+
+		It("Should report the failure in the MapBuilt condition and retry the build on request", func() {
+			Eventually(func() string {
+				valhalla := &valhallav1alpha1.Valhalla{}
+				Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(instance), valhalla)).To(Succeed())
+				if condition := meta.FindStatusCondition(valhalla.Status.Conditions, status.ConditionMapBuilt); condition != nil {
+					return condition.Reason
+				}
+				return ""
+			}, MapBuildingTimeout).Should(Equal("MapBuildFailed"))
+
+			Expect(updateWithRetry(instance, func(v *valhallav1alpha1.Valhalla) {
+				v.Annotations = map[string]string{valhallav1alpha1.ActionAnnotationPrefix + valhallav1alpha1.RetryMapBuildAction: "1"}
+			})).To(Succeed())
+
+			Eventually(func() int32 {
+				valhalla := &valhallav1alpha1.Valhalla{}
+				Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(instance), valhalla)).To(Succeed())
+				return valhalla.Status.MapBuildRetries(valhalla.DesiredMapVersion())
+			}, 10*time.Second).Should(Equal(int32(1)))
+		})
+	})
+
+	Context("Actions", func() {
+		BeforeEach(func() {
+			instance = generateValhallaCluster("actions")
+			Expect(k8sClient.Create(ctx, instance)).To(Succeed())
+			waitForValhallaDeployment(ctx, instance, k8sClient)
+		})
+
+		AfterEach(func() {
+			Expect(k8sClient.Delete(ctx, instance)).To(Succeed())
+		})
+
+		It("Should restart the workers and acknowledge the action", func() {
+			Expect(updateWithRetry(instance, func(v *valhallav1alpha1.Valhalla) {
+				v.Annotations = map[string]string{valhallav1alpha1.ActionAnnotationPrefix + valhallav1alpha1.RestartWorkersAction: "1"}
+			})).To(Succeed())
+
+			Eventually(func() bool {
+				valhalla := &valhallav1alpha1.Valhalla{}
+				Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(instance), valhalla)).To(Succeed())
+				_, pending := valhalla.PendingAction(valhallav1alpha1.RestartWorkersAction)
+				return pending
+			}, 10*time.Second).Should(BeFalse())
+
+			Eventually(func() map[string]string {
+				return deployment(ctx, instance, "").Spec.Template.Annotations
+			}, 10*time.Second).Should(HaveKey("valhalla.itayankri/restarted-at"))
+		})
+
+		It("Should promote a rebuilt map only once its builder Job completes", func() {
+			valhalla := &valhallav1alpha1.Valhalla{}
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(instance), valhalla)).To(Succeed())
+			builtMapVersion := valhalla.Status.MapVersion
+
+			Expect(updateWithRetry(instance, func(v *valhallav1alpha1.Valhalla) {
+				v.Annotations = map[string]string{valhallav1alpha1.ActionAnnotationPrefix + valhallav1alpha1.RebuildMapAction: "1"}
+			})).To(Succeed())
+
+			Eventually(func() string {
+				Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(instance), valhalla)).To(Succeed())
+				return valhalla.Status.MapVersion
+			}, MapBuildingTimeout).ShouldNot(Equal(builtMapVersion))
+			Expect(valhalla.Status.MapVersion).To(Equal(valhalla.DesiredMapVersion()))
+
+			job := &batchv1.Job{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{
+				Name:      valhallaresource.MapBuilderJobName(valhalla),
+				Namespace: valhalla.Namespace,
+			}, job)).To(Succeed())
+			Expect(job.Status.Succeeded).To(BeNumerically(">", 0))
+		})
+
+		It("Should complete a rebuild that was acknowledged before its annotation was patched", func() {
+			valhalla := &valhallav1alpha1.Valhalla{}
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(instance), valhalla)).To(Succeed())
+			refreshTime := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+			valhalla.Status.MapRefreshTime = &metav1.Time{Time: refreshTime}
+			valhalla.Status.AcknowledgeAction(valhallav1alpha1.RebuildMapAction, "1")
+			Expect(k8sClient.Status().Update(ctx, valhalla)).To(Succeed())
+
+			Eventually(func() string {
+				Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(instance), valhalla)).To(Succeed())
+				return valhalla.Annotations[valhallav1alpha1.MapRefreshAnnotation]
+			}, 10*time.Second).Should(Equal(refreshTime.Format(time.RFC3339)))
+
+			Expect(updateWithRetry(instance, func(v *valhallav1alpha1.Valhalla) {
+				v.Annotations[valhallav1alpha1.ActionAnnotationPrefix+valhallav1alpha1.RebuildMapAction] = "1"
+			})).To(Succeed())
+			Consistently(func() string {
+				Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(instance), valhalla)).To(Succeed())
+				return valhalla.Annotations[valhallav1alpha1.MapRefreshAnnotation]
+			}, 5*time.Second).Should(Equal(refreshTime.Format(time.RFC3339)))
+		})
+	})
+
+	Context("Map refresh", func() {
+		BeforeEach(func() {
+			instance = generateValhallaCluster("map-refresh")
+			Expect(k8sClient.Create(ctx, instance)).To(Succeed())
+			waitForValhallaDeployment(ctx, instance, k8sClient)
+		})
+
+		AfterEach(func() {
+			Expect(k8sClient.Delete(ctx, instance)).To(Succeed())
+		})
+
+		It("Should start the refresh schedule when map refreshes are enabled instead of rebuilding the map", func() {
+			valhalla := &valhallav1alpha1.Valhalla{}
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(instance), valhalla)).To(Succeed())
+			builtMapVersion := valhalla.Status.MapVersion
+
+			Expect(updateWithRetry(instance, func(v *valhallav1alpha1.Valhalla) {
+				v.Spec.MapRefresh = &valhallav1alpha1.MapRefreshSpec{Schedule: "0 0 1 1 *"}
+			})).To(Succeed())
+
+			Eventually(func() map[string]string {
+				Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(instance), valhalla)).To(Succeed())
+				return valhalla.Annotations
+			}, 10*time.Second).Should(HaveKey(valhallav1alpha1.MapRefreshEnabledAnnotation))
+			Expect(valhalla.Annotations).NotTo(HaveKey(valhallav1alpha1.MapRefreshAnnotation))
+			Expect(valhalla.DesiredMapVersion()).To(Equal(builtMapVersion))
+		})
+	})
+
+	Context("Retain PersistentVolumeClaim", func() {
+		BeforeEach(func() {
+			instance = generateValhallaCluster("retain-pvc")
+			instance.Spec.Persistence.ReclaimPolicy = valhallav1alpha1.ReclaimPolicyRetain
+			Expect(k8sClient.Create(ctx, instance)).To(Succeed())
+			waitForValhallaDeployment(ctx, instance, k8sClient)
+		})
+
+		It("Should orphan and label the PersistentVolumeClaim when the instance is deleted", func() {
+			Expect(k8sClient.Delete(ctx, instance)).To(Succeed())
+			Eventually(func() bool {
+				return errors.IsNotFound(k8sClient.Get(ctx, client.ObjectKeyFromObject(instance), &valhallav1alpha1.Valhalla{}))
+			}, ClusterDeletionTimeout).Should(BeTrue())
+
+			pvc := &corev1.PersistentVolumeClaim{}
+			Consistently(func() error {
+				return k8sClient.Get(ctx, types.NamespacedName{Name: instance.Name, Namespace: instance.Namespace}, pvc)
+			}, 5*time.Second).Should(Succeed())
+			Expect(pvc.OwnerReferences).To(BeEmpty())
+			Expect(pvc.Labels).To(HaveKeyWithValue("valhalla.itayankri/retained-from", instance.Name))
+			Expect(pvc.Annotations).To(HaveKeyWithValue("valhalla.itayankri/map-sources-hash", instance.MapSourcesHash()))
+			Expect(k8sClient.Delete(ctx, pvc)).To(Succeed())
+		})
+	})
+
+	Context("Snapshot PersistentVolumeClaim before deletion", func() {
+		BeforeEach(func() {
+			instance = generateValhallaCluster("snapshot-pvc")
+			instance.Spec.Persistence.SnapshotBeforeDeletion = &valhallav1alpha1.VolumeSnapshotSpec{}
+			Expect(k8sClient.Create(ctx, instance)).To(Succeed())
+			waitForValhallaDeployment(ctx, instance, k8sClient)
+		})
+
+		It("Should keep the finalizer until the VolumeSnapshot is ready", func() {
+			Expect(k8sClient.Delete(ctx, instance)).To(Succeed())
+
+			snapshots := &unstructured.UnstructuredList{}
+			snapshots.SetGroupVersionKind(valhallaresource.VolumeSnapshotGroupVersionKind)
+			Eventually(func() []unstructured.Unstructured {
+				Expect(k8sClient.List(ctx, snapshots, client.InNamespace(instance.Namespace),
+					client.MatchingLabels{valhallaresource.RetainedLabel: instance.Name})).To(Succeed())
+				return snapshots.Items
+			}, 10*time.Second).Should(HaveLen(1))
+
+			Consistently(func() []string {
+				valhalla := &valhallav1alpha1.Valhalla{}
+				Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(instance), valhalla)).To(Succeed())
+				Expect(valhalla.Status.Phase).To(Equal(valhallav1alpha1.PhaseDeleting))
+				return valhalla.Finalizers
+			}, 10*time.Second).Should(ContainElement("valhalla.itayankri/finalizer"))
+
+			// Repeated events are aggregated by the recorder, so their counts are summed.
+			events := &corev1.EventList{}
+			Expect(k8sClient.List(ctx, events, client.InNamespace(instance.Namespace))).To(Succeed())
+			cleanupEvents := int32(0)
+			for _, event := range events.Items {
+				if event.InvolvedObject.UID == instance.UID && event.Reason == "Cleanup" {
+					if event.Count > 0 {
+						cleanupEvents += event.Count
+					} else {
+						cleanupEvents++
+					}
+				}
+			}
+			Expect(cleanupEvents).To(Equal(int32(1)))
+
+			snapshot := &snapshots.Items[0]
+			Expect(unstructured.SetNestedField(snapshot.Object, true, "status", "readyToUse")).To(Succeed())
+			Expect(k8sClient.Status().Update(ctx, snapshot)).To(Succeed())
+
+			Eventually(func() bool {
+				return errors.IsNotFound(k8sClient.Get(ctx, client.ObjectKeyFromObject(instance), &valhallav1alpha1.Valhalla{}))
+			}, 20*time.Second).Should(BeTrue())
+			Expect(k8sClient.Delete(ctx, snapshot)).To(Succeed())
+		})
+	})
+
+	Context("Snapshot PersistentVolumeClaim without the VolumeSnapshot CRDs", func() {
+		It("Should release the claim without a snapshot and record a warning", func() {
+			valhalla := generateValhallaCluster("snapshot-unavailable")
+			valhalla.UID = "snapshot-unavailable"
+			valhalla.Finalizers = []string{"valhalla.itayankri/finalizer"}
+			valhalla.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+			valhalla.Spec.Persistence.SnapshotBeforeDeletion = &valhallav1alpha1.VolumeSnapshotSpec{}
+			pvc := &corev1.PersistentVolumeClaim{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:            valhalla.ChildResourceName(valhallaresource.PersistentVolumeClaimSuffix),
+					Namespace:       valhalla.Namespace,
+					OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(valhalla, valhallav1alpha1.GroupVersion.WithKind("Valhalla"))},
+				},
+			}
+			fakeClient := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(valhalla, pvc).Build()
+			recorder := record.NewFakeRecorder(10)
+			reconciler := controllers.NewValhallaReconciler(noVolumeSnapshotsClient{fakeClient}, fakeClient, scheme.Scheme, recorder)
+
+			_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(valhalla)})
+			Expect(err).NotTo(HaveOccurred())
+
+			// The instance is gone once its finalizer is removed.
+			err = fakeClient.Get(ctx, client.ObjectKeyFromObject(valhalla), &valhallav1alpha1.Valhalla{})
+			Expect(errors.IsNotFound(err)).To(BeTrue())
+			Expect(recorder.Events).To(Receive(HavePrefix("Normal Cleanup")))
+			Expect(recorder.Events).To(Receive(HavePrefix("Warning VolumeSnapshotUnavailable")))
+		})
+	})
+
 	Context("Pause reconciliation", func() {
 		BeforeEach(func() {
 			instance = generateValhallaCluster("pause-reconcile")
@@ -214,13 +595,48 @@ var _ = Describe("ValhallaController", func() {
 			Eventually(func() int32 {
 				return *hpa(ctx, instance, "").Spec.MinReplicas
 			}, 10*time.Second).Should(Equal(minReplicas))
+
+			valhalla := &valhallav1alpha1.Valhalla{}
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(instance), valhalla)).To(Succeed())
+			Expect(valhalla.Status.Paused).To(BeFalse())
+		})
+
+		It("Should record the paused components and keep reconciling the others", func() {
+			minReplicas := int32(2)
+			Expect(updateWithRetry(instance, func(v *valhallav1alpha1.Valhalla) {
+				v.SetAnnotations(map[string]string{valhallav1alpha1.WorkersPausedAnnotation: "true"})
+				v.Spec.MinReplicas = &minReplicas
+			})).To(Succeed())
+
+			Eventually(func() []string {
+				valhalla := &valhallav1alpha1.Valhalla{}
+				Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(instance), valhalla)).To(Succeed())
+				return valhalla.Status.PausedComponents
+			}, 10*time.Second).Should(Equal([]string{"workers"}))
+
+			Eventually(func() int32 {
+				return *hpa(ctx, instance, "").Spec.MinReplicas
+			}, 10*time.Second).Should(Equal(minReplicas))
+			Expect(deployment(ctx, instance, "").Spec.Paused).To(BeTrue())
 		})
 	})
 })
 
+// noVolumeSnapshotsClient behaves as a client of a cluster without the VolumeSnapshot CRDs.
+type noVolumeSnapshotsClient struct {
+	client.Client
+}
+
+func (c noVolumeSnapshotsClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	if gvk := obj.GetObjectKind().GroupVersionKind(); gvk == valhallaresource.VolumeSnapshotGroupVersionKind {
+		return &meta.NoKindMatchError{GroupKind: gvk.GroupKind(), SearchedVersions: []string{gvk.Version}}
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
 func generateValhallaCluster(name string) *valhallav1alpha1.Valhalla {
 	storage := resource.MustParse("10Mi")
-	image := "itayankri/valhalla:latest"
+	image := "itayankri/valhalla-worker:latest"
 	minReplicas := int32(1)
 	maxReplicas := int32(3)
 	valhalla := &valhallav1alpha1.Valhalla{
@@ -294,9 +710,9 @@ func waitForValhallaDeployment(ctx context.Context, instance *valhallav1alpha1.V
 	}, MapBuildingTimeout, 1*time.Second).Should(Equal("ready"))
 }
 
-func hpa(ctx context.Context, v *valhallav1alpha1.Valhalla, hpaName string) *autoscalingv1.HorizontalPodAutoscaler {
+func hpa(ctx context.Context, v *valhallav1alpha1.Valhalla, hpaName string) *autoscalingv2.HorizontalPodAutoscaler {
 	name := v.ChildResourceName(hpaName)
-	hpa := &autoscalingv1.HorizontalPodAutoscaler{}
+	hpa := &autoscalingv2.HorizontalPodAutoscaler{}
 	EventuallyWithOffset(1, func() error {
 		if err := k8sClient.Get(
 			ctx,
@@ -6,39 +6,125 @@ CONF_DIR="conf"
 echo "Evironment:"
 printenv
 
+# fail writes the reason of a failed build to the termination log,
+# which the operator reports on the Valhalla resource.
+fail() {
+  echo "$1" | tee /dev/termination-log
+  exit 1
+}
+
+# verify_checksum compares a downloaded extract against a checksum given as
+# <algorithm>:<value> or <algorithm>:<sidecar file URL>. "-" skips verification.
+verify_checksum() {
+  local PBF_URL=$1
+  local PBF_FILE_NAME=$2
+  local CHECKSUM=$3
+
+  if [[ -z "$CHECKSUM" || "$CHECKSUM" == "-" ]]; then
+    return
+  fi
+
+  local ALGORITHM=${CHECKSUM%%:*}
+  local EXPECTED=${CHECKSUM#*:}
+  if [[ "$EXPECTED" == http://* || "$EXPECTED" == https://* ]]; then
+    echo "Downloading checksum from $EXPECTED"
+    EXPECTED=$(wget -qO- $EXPECTED | awk '{print $1}')
+    if [[ -z "$EXPECTED" ]]; then
+      fail "ChecksumUnavailable: failed to download the checksum of $PBF_URL from ${CHECKSUM#*:}"
+    fi
+  fi
+
+  echo "Verifying $ALGORITHM checksum of $PBF_FILE_NAME"
+  local ACTUAL=$(${ALGORITHM}sum $PBF_FILE_NAME | awk '{print $1}')
+  if [[ "${ACTUAL,,}" != "${EXPECTED,,}" ]]; then
+    fail "ChecksumMismatch: $ALGORITHM checksum of $PBF_URL is $ACTUAL, expected $EXPECTED"
+  fi
+}
+
 if [[ -z "${ROOT_DIR}" ]]; then
   echo "ROOT_DIR environemnt variable must be provided"
   exit 1
 fi
 
-cd $ROOT_DIR
-mkdir $TILES_DIR $CONF_DIR
+if [[ -n "${MAP_VERSION}" ]]; then
+  # Every map version is built into a directory of its own, so the workers keep
+  # serving the active version until this build completes.
+  MAPS_DIR="$ROOT_DIR/maps"
+  mkdir -p $MAPS_DIR
 
-if [[ -z "${PBF_URL}" ]]; then
-  echo "PBF_URL environemnt variable must be provided"
+  for MAP_DIR in $MAPS_DIR/*/; do
+    VERSION=$(basename $MAP_DIR)
+    if [[ "$VERSION" != "$MAP_VERSION" && "$VERSION" != "$ACTIVE_MAP_VERSION" ]]; then
+      echo "Removing stale map version $VERSION"
+      rm -rf $MAP_DIR
+    fi
+  done
+
+  ROOT_DIR="$MAPS_DIR/$MAP_VERSION"
+  rm -rf $ROOT_DIR
+  mkdir -p $ROOT_DIR
+fi
+
+cd $ROOT_DIR || fail "MapDirectoryUnavailable: failed to enter $ROOT_DIR"
+mkdir $TILES_DIR $CONF_DIR || fail "MapDirectoryUnavailable: failed to create the directories of the map in $ROOT_DIR"
+
+PBF_URLS=${PBF_URLS:=$PBF_URL}
+if [[ -z "${PBF_URLS}" ]]; then
+  echo "PBF_URLS environemnt variable must be provided"
   exit 1
 fi
 
-PBF_FILE_NAME=$(basename $PBF_URL)
+# Each extract is prefixed with its index so that files with the same name from
+# different sources do not overwrite each other.
+PBF_CHECKSUMS=($PBF_CHECKSUMS)
+PBF_FILE_NAMES=()
+for PBF_URL in $PBF_URLS; do
+  INDEX=${#PBF_FILE_NAMES[@]}
+  PBF_FILE_NAME="$INDEX-$(basename $PBF_URL)"
+  echo "Downloading PBF from $PBF_URL"
+  wget -O $PBF_FILE_NAME $PBF_URL || fail "DownloadFailed: failed to download $PBF_URL"
+  verify_checksum $PBF_URL $PBF_FILE_NAME "${PBF_CHECKSUMS[$INDEX]}"
+  PBF_FILE_NAMES+=($PBF_FILE_NAME)
+done
 
-echo "Downloading PBF from $PBF_URL"
-wget $PBF_URL
+# The checksums of the extracts are reported to the operator, using the
+# algorithm of the configured checksum, or md5 for unverified extracts.
+REPORTED_CHECKSUMS=()
+for INDEX in ${!PBF_FILE_NAMES[@]}; do
+  CHECKSUM="${PBF_CHECKSUMS[$INDEX]}"
+  ALGORITHM=md5
+  if [[ -n "$CHECKSUM" && "$CHECKSUM" != "-" ]]; then
+    ALGORITHM=${CHECKSUM%%:*}
+  fi
+  REPORTED_CHECKSUMS+=("\"$ALGORITHM:$(${ALGORITHM}sum ${PBF_FILE_NAMES[$INDEX]} | awk '{print $1}')\"")
+done
 
 echo "Building configuration file..."
 valhalla_build_config --mjolnir-tile-dir $ROOT_DIR/$TILES_DIR \
   --mjolnir-tile-extract $ROOT_DIR/valhalla_tiles.tar \
   --mjolnir-timezone $ROOT_DIR/$TILES_DIR/timezones.sqlite \
   --mjolnir-admin $ROOT_DIR/$TILES_DIR/admins.sqlite \
-  --mjolnir-traffic-extract $ROOT_DIR/traffic.tar > $ROOT_DIR/$CONF_DIR/valhalla.json
+  --mjolnir-traffic-extract $ROOT_DIR/traffic.tar > $ROOT_DIR/$CONF_DIR/valhalla.json \
+  || fail "ConfigBuildFailed: failed to build the valhalla configuration"
 
 echo "Building admins..."
-valhalla_build_admins --config ./$CONF_DIR/valhalla.json $PBF_FILE_NAME
+valhalla_build_admins --config ./$CONF_DIR/valhalla.json ${PBF_FILE_NAMES[@]} \
+  || fail "AdminsBuildFailed: failed to build the admins database"
 
 echo "Building timezones..."
-valhalla_build_timezones > ./$TILES_DIR/timezones.sqlite
+valhalla_build_timezones > ./$TILES_DIR/timezones.sqlite \
+  || fail "TimezonesBuildFailed: failed to build the timezones database"
 
 echo "Building tiles..."
-valhalla_build_tiles --config ./$CONF_DIR/valhalla.json $PBF_FILE_NAME
+valhalla_build_tiles --config ./$CONF_DIR/valhalla.json ${PBF_FILE_NAMES[@]} \
+  || fail "TilesBuildFailed: failed to build the tiles"
 
 echo "Packing files into tar file..."
-find $TILES_DIR | sort -n | tar -cf "valhalla_tiles.tar" --no-recursion -T -
+set -o pipefail
+find $TILES_DIR | sort -n | tar -cf "valhalla_tiles.tar" --no-recursion -T - \
+  || fail "TarFailed: failed to pack the tiles into a tar file"
+
+# The build report is read by the operator from the termination log.
+TILE_EXTRACT_SIZE=$(stat -c %s valhalla_tiles.tar)
+CHECKSUMS_JSON=$(IFS=,; echo "${REPORTED_CHECKSUMS[*]}")
+echo "{\"checksums\":[$CHECKSUMS_JSON],\"tileExtractSize\":$TILE_EXTRACT_SIZE}" | tee /dev/termination-log
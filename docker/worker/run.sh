@@ -10,5 +10,29 @@ fi
 
 cd $ROOT_DIR
 
+CONFIG_FILE="./$CONF_DIR/valhalla.json"
+if [[ -n "${CONFIG_OVERLAY}" && -f "${CONFIG_OVERLAY}" ]]; then
+  # The map volume is shared by all workers and mounted read-only, so the
+  # configuration rendered by the operator is merged into a local copy.
+  echo "Merging configuration from $CONFIG_OVERLAY..."
+  python3 - $CONFIG_FILE $CONFIG_OVERLAY > /tmp/valhalla.json <<'PYTHON' || exit 1
+import json
+import sys
+
+def merge(config, overlay):
+    for key, value in overlay.items():
+        if isinstance(value, dict) and isinstance(config.get(key), dict):
+            merge(config[key], value)
+        else:
+            config[key] = value
+
+with open(sys.argv[1]) as config_file, open(sys.argv[2]) as overlay_file:
+    config = json.load(config_file)
+    merge(config, json.load(overlay_file))
+json.dump(config, sys.stdout, indent=2)
+PYTHON
+  CONFIG_FILE="/tmp/valhalla.json"
+fi
+
 echo "Starting Valhalla server with $THREADS threads..."
-valhalla_service ./$CONF_DIR/valhalla.json $THREADS
\ No newline at end of file
+valhalla_service $CONFIG_FILE $THREADS
@@ -6,6 +6,7 @@ require (
 	github.com/go-logr/logr v1.2.4
 	github.com/onsi/ginkgo v1.16.5
 	github.com/onsi/gomega v1.27.10
+	github.com/robfig/cron/v3 v3.0.1
 	k8s.io/api v0.25.3
 	k8s.io/apimachinery v0.27.3
 	k8s.io/client-go v0.25.3
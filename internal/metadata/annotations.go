@@ -1,11 +1,51 @@
 package metadata
 
-import "strings"
+import (
+	"sort"
+	"strings"
+)
+
+// ManagedAnnotationsAnnotation lists the annotations of a resource that were set by the operator,
+// so that the ones removed from the spec can be removed without touching those added by other tools.
+const ManagedAnnotationsAnnotation = "valhalla.itayankri/managed-annotations"
 
 func ReconcileAnnotations(existing map[string]string, defaults ...map[string]string) map[string]string {
 	return merge(existing, defaults...)
 }
 
+// ReconcileManagedAnnotations merges the desired annotations into the existing ones and removes
+// the annotations that were set by a previous reconciliation and are no longer desired.
+func ReconcileManagedAnnotations(existing map[string]string, desired map[string]string) map[string]string {
+	annotations := map[string]string{}
+	for k, v := range existing {
+		annotations[k] = v
+	}
+
+	if managed, ok := annotations[ManagedAnnotationsAnnotation]; ok {
+		for _, k := range strings.Split(managed, ",") {
+			if _, ok := desired[k]; !ok {
+				delete(annotations, k)
+			}
+		}
+		delete(annotations, ManagedAnnotationsAnnotation)
+	}
+
+	keys := []string{}
+	for k, v := range desired {
+		annotations[k] = v
+		keys = append(keys, k)
+	}
+	if len(keys) > 0 {
+		sort.Strings(keys)
+		annotations[ManagedAnnotationsAnnotation] = strings.Join(keys, ",")
+	}
+
+	if len(annotations) == 0 {
+		return nil
+	}
+	return annotations
+}
+
 func merge(baseAnnotations map[string]string, maps ...map[string]string) map[string]string {
 	annotations := map[string]string{}
 	if baseAnnotations != nil {
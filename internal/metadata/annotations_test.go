@@ -48,4 +48,27 @@ var _ = Describe("Annotations", func() {
 			Expect(len(reconciledAnnotations)).To(Equal(0))
 		})
 	})
+	Context("ReconcileManagedAnnotations", func() {
+		It("Should remove only the annotations previously set from the desired ones", func() {
+			existing := map[string]string{
+				defaultAnnotationKey:                  defaultAnnotationValue,
+				"removed":                             "true",
+				"kept":                                "true",
+				metadata.ManagedAnnotationsAnnotation: "kept,removed",
+			}
+			reconciledAnnotations := metadata.ReconcileManagedAnnotations(existing, map[string]string{"kept": "false", "added": "true"})
+			Expect(reconciledAnnotations).To(Equal(map[string]string{
+				defaultAnnotationKey:                  defaultAnnotationValue,
+				"kept":                                "false",
+				"added":                               "true",
+				metadata.ManagedAnnotationsAnnotation: "added,kept",
+			}))
+			Expect(existing).To(HaveKey("removed"))
+		})
+
+		It("Should remove the managed annotations when none are desired", func() {
+			existing := map[string]string{"removed": "true", metadata.ManagedAnnotationsAnnotation: "removed"}
+			Expect(metadata.ReconcileManagedAnnotations(existing, nil)).To(BeEmpty())
+		})
+	})
 })
@@ -0,0 +1,148 @@
+package resource
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	valhallav1alpha1 "github.com/itayankri/valhalla-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+type ConfigMapBuilder struct {
+	*ValhallaResourceBuilder
+}
+
+func (builder *ValhallaResourceBuilder) ConfigMap() *ConfigMapBuilder {
+	return &ConfigMapBuilder{builder}
+}
+
+func (builder *ConfigMapBuilder) Build() (client.Object, error) {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      builder.Instance.ChildResourceName(ConfigMapSuffix),
+			Namespace: builder.Instance.Namespace,
+		},
+	}, nil
+}
+
+func (builder *ConfigMapBuilder) Update(object client.Object) error {
+	configMap := object.(*corev1.ConfigMap)
+
+	config, err := renderConfig(builder.Instance.Spec.Config)
+	if err != nil {
+		return err
+	}
+
+	configMap.Data = map[string]string{
+		valhallaConfigFileName: string(config),
+	}
+
+	if err := controllerutil.SetControllerReference(builder.Instance, configMap, builder.Scheme); err != nil {
+		return fmt.Errorf("failed setting controller reference: %v", err)
+	}
+
+	return nil
+}
+
+func (builder *ConfigMapBuilder) ShouldDeploy(resources []runtime.Object) bool {
+	return true
+}
+
+// renderConfig renders spec.config into a valhalla.json fragment that the workers
+// merge over the configuration generated by the map builder.
+func renderConfig(spec *valhallav1alpha1.ConfigSpec) ([]byte, error) {
+	config := map[string]interface{}{}
+	if spec == nil {
+		return json.Marshal(config)
+	}
+
+	if len(spec.Actions) > 0 {
+		// The status action is always served, the probes of the workers depend on it.
+		actions := spec.Actions
+		if !containsString(actions, "status") {
+			actions = append(append([]string{}, actions...), "status")
+		}
+		config["loki"] = map[string]interface{}{
+			"actions": actions,
+		}
+	}
+
+	if spec.TimeoutSeconds != nil {
+		config["httpd"] = map[string]interface{}{
+			"service": map[string]interface{}{
+				"timeout_seconds": *spec.TimeoutSeconds,
+			},
+		}
+	}
+
+	if len(spec.ServiceLimits) > 0 {
+		serviceLimits := map[string]interface{}{}
+		for costing, limits := range spec.ServiceLimits {
+			costingLimits := map[string]interface{}{}
+			if limits.MaxDistance != nil {
+				costingLimits["max_distance"] = *limits.MaxDistance
+			}
+			if limits.MaxLocations != nil {
+				costingLimits["max_locations"] = *limits.MaxLocations
+			}
+			if limits.MaxMatrixDistance != nil {
+				costingLimits["max_matrix_distance"] = *limits.MaxMatrixDistance
+			}
+			if limits.MaxMatrixLocationPairs != nil {
+				costingLimits["max_matrix_location_pairs"] = *limits.MaxMatrixLocationPairs
+			}
+			serviceLimits[costing] = costingLimits
+		}
+		config["service_limits"] = serviceLimits
+	}
+
+	if spec.Overlay != nil && len(spec.Overlay.Raw) > 0 {
+		overlay := map[string]interface{}{}
+		if err := json.Unmarshal(spec.Overlay.Raw, &overlay); err != nil {
+			return nil, fmt.Errorf("failed to parse config overlay: %v", err)
+		}
+		mergeConfig(config, overlay)
+	}
+
+	return json.Marshal(config)
+}
+
+// mergeConfig deep merges overlay into config. Objects are merged key by key,
+// any other value in the overlay replaces the one in config.
+func mergeConfig(config, overlay map[string]interface{}) {
+	for key, value := range overlay {
+		overlayObject, isObject := value.(map[string]interface{})
+		configObject, isConfigObject := config[key].(map[string]interface{})
+		if isObject && isConfigObject {
+			mergeConfig(configObject, overlayObject)
+			continue
+		}
+		config[key] = value
+	}
+}
+
+// configHash returns a digest of the rendered configuration. It is set as an annotation
+// on the worker pods, so that a change in the configuration rolls them out.
+func configHash(spec *valhallav1alpha1.ConfigSpec) (string, error) {
+	config, err := renderConfig(spec)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(config)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
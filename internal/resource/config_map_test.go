@@ -0,0 +1,83 @@
+package resource_test
+
+import (
+	valhallav1alpha1 "github.com/itayankri/valhalla-operator/api/v1alpha1"
+	"github.com/itayankri/valhalla-operator/internal/resource"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+var _ = Describe("ConfigMap builder", func() {
+	var instance *valhallav1alpha1.Valhalla
+	var builder resource.ResourceBuilder
+	BeforeEach(func() {
+		instance = &valhallav1alpha1.Valhalla{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test",
+				Namespace: "default",
+			},
+		}
+		builder = (&resource.ValhallaResourceBuilder{Instance: instance, Scheme: scheme}).ConfigMap()
+	})
+
+	renderedConfig := func() string {
+		object, err := builder.Build()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(builder.Update(object)).To(Succeed())
+		return object.(*corev1.ConfigMap).Data["valhalla.json"]
+	}
+
+	It("Should name the ConfigMap after the instance", func() {
+		object, err := builder.Build()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(object.GetName()).To(Equal("test-config"))
+	})
+
+	It("Should render an empty config when spec.config is not set", func() {
+		Expect(renderedConfig()).To(MatchJSON(`{}`))
+	})
+
+	It("Should render the typed config", func() {
+		timeoutSeconds := int32(10)
+		maxLocations := int32(50)
+		maxDistance := int64(100000)
+		instance.Spec.Config = &valhallav1alpha1.ConfigSpec{
+			Actions:        []string{"route", "isochrone"},
+			TimeoutSeconds: &timeoutSeconds,
+			ServiceLimits: map[string]valhallav1alpha1.ServiceLimitsSpec{
+				"auto": {MaxLocations: &maxLocations, MaxDistance: &maxDistance},
+			},
+		}
+		Expect(renderedConfig()).To(MatchJSON(`{
+			"loki": {"actions": ["route", "isochrone", "status"]},
+			"httpd": {"service": {"timeout_seconds": 10}},
+			"service_limits": {"auto": {"max_locations": 50, "max_distance": 100000}}
+		}`))
+	})
+
+	It("Should merge the overlay over the typed config", func() {
+		timeoutSeconds := int32(10)
+		instance.Spec.Config = &valhallav1alpha1.ConfigSpec{
+			TimeoutSeconds: &timeoutSeconds,
+			Overlay: &runtime.RawExtension{
+				Raw: []byte(`{"httpd": {"service": {"timeout_seconds": 20, "drain_seconds": 5}}, "thor": {"logging": {"long_request": 100}}}`),
+			},
+		}
+		Expect(renderedConfig()).To(MatchJSON(`{
+			"httpd": {"service": {"timeout_seconds": 20, "drain_seconds": 5}},
+			"thor": {"logging": {"long_request": 100}}
+		}`))
+	})
+
+	It("Should fail when the overlay is not a JSON object", func() {
+		instance.Spec.Config = &valhallav1alpha1.ConfigSpec{
+			Overlay: &runtime.RawExtension{Raw: []byte(`["route"]`)},
+		}
+		object, err := builder.Build()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(builder.Update(object)).NotTo(Succeed())
+	})
+})
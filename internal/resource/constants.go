@@ -1,6 +1,7 @@
 package resource
 
 const valhallaDataPath = "/data"
+const valhallaMapsPath = valhallaDataPath + "/maps"
 const workerImage = "itayankri/valhalla-worker:latest"
 const mapBuilderImage = "itayankri/valhalla-builder:latest"
 const hirtoricalTrafficDataFetcherImage = "itayankri/valhalla-predicted-traffic:latest"
@@ -9,7 +10,32 @@ const DeploymentSuffix = ""
 const HorizontalPodAutoscalerSuffix = ""
 const JobSuffix = "builder"
 const CronJobSuffix = "predicted-traffic"
+const ConfigMapSuffix = "config"
 const PersistentVolumeClaimSuffix = ""
 const PodDisruptionBudgetSuffix = ""
 const ServiceSuffix = ""
+const IngressSuffix = ""
+const WorkersNetworkPolicySuffix = "workers"
+const BuilderNetworkPolicySuffix = "builder"
+const PredictedTrafficNetworkPolicySuffix = "predicted-traffic"
+const HTTPRouteSuffix = ""
+const servicePort = 80
 const containerPort = 8002
+const statusPath = "/status"
+const valhallaConfigPath = "/etc/valhalla"
+const valhallaConfigFileName = "valhalla.json"
+const configVolumeName = "valhalla-config"
+
+const MapVersionLabel = "valhalla.itayankri/map-version"
+const ConfigHashAnnotation = "valhalla.itayankri/config-hash"
+const MapVersionAnnotation = "valhalla.itayankri/map-version"
+const SecretsHashAnnotation = "valhalla.itayankri/secrets-hash"
+const RestartedAtAnnotation = "valhalla.itayankri/restarted-at"
+
+// MapSourcesHashAnnotation records on a retained PersistentVolumeClaim the hash of the PBF sources
+// its map was built from, so that a new instance with the same sources can adopt the map.
+const MapSourcesHashAnnotation = "valhalla.itayankri/map-sources-hash"
+
+// RetainedLabel marks a PersistentVolumeClaim that was retained after its instance was deleted.
+// Its value is the name of the instance, so that a new instance of the same name can adopt it.
+const RetainedLabel = "valhalla.itayankri/retained-from"
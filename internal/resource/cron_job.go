@@ -3,7 +3,7 @@ package resource
 import (
 	"fmt"
 
-	"github.com/itayankri/valhalla-operator/internal/status"
+	valhallav1alpha1 "github.com/itayankri/valhalla-operator/api/v1alpha1"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
@@ -32,9 +32,11 @@ func (builder *CronJobBuilder) Build() (client.Object, error) {
 
 func (builder *CronJobBuilder) Update(object client.Object) error {
 	cronJob := object.(*batchv1.CronJob)
+	suspend := builder.Instance.IsPaused(valhallav1alpha1.PredictedTrafficPausedAnnotation)
 
-	cronJob.Spec = batchv1.CronJobSpec{
+	cronJob.Spec = withCronJobDefaults(batchv1.CronJobSpec{
 		Schedule: builder.Instance.Spec.PredictedTraffic.Schedule,
+		Suspend:  &suspend,
 		JobTemplate: batchv1.JobTemplateSpec{
 			ObjectMeta: metav1.ObjectMeta{
 				Name:      builder.Instance.ChildResourceName(CronJobSuffix),
@@ -42,12 +44,19 @@ func (builder *CronJobBuilder) Update(object client.Object) error {
 			},
 			Spec: batchv1.JobSpec{
 				Template: corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{
+						Labels: map[string]string{
+							"app": builder.Instance.ChildResourceName(CronJobSuffix),
+						},
+					},
 					Spec: corev1.PodSpec{
-						RestartPolicy: corev1.RestartPolicyOnFailure,
+						RestartPolicy:    corev1.RestartPolicyOnFailure,
+						ImagePullSecrets: builder.Instance.Spec.ImagePullSecrets,
 						Containers: []corev1.Container{
 							{
-								Name:  builder.Instance.ChildResourceName(CronJobSuffix),
-								Image: hirtoricalTrafficDataFetcherImage,
+								Name:            builder.Instance.ChildResourceName(CronJobSuffix),
+								Image:           imageOrDefault(builder.Instance.Spec.PredictedTraffic.Image, hirtoricalTrafficDataFetcherImage),
+								ImagePullPolicy: builder.Instance.Spec.ImagePullPolicy,
 								Resources: corev1.ResourceRequirements{
 									Requests: map[corev1.ResourceName]resource.Quantity{
 										"memory": resource.MustParse("100M"),
@@ -57,7 +66,7 @@ func (builder *CronJobBuilder) Update(object client.Object) error {
 								Env: []corev1.EnvVar{
 									{
 										Name:  "ROOT_DIR",
-										Value: valhallaDataPath,
+										Value: mapPath(builder.servedMapVersion()),
 									},
 									{
 										Name:  "URL",
@@ -87,7 +96,7 @@ func (builder *CronJobBuilder) Update(object client.Object) error {
 				},
 			},
 		},
-	}
+	})
 
 	if err := controllerutil.SetControllerReference(builder.Instance, cronJob, builder.Scheme); err != nil {
 		return fmt.Errorf("failed setting controller reference: %v", err)
@@ -97,7 +106,9 @@ func (builder *CronJobBuilder) Update(object client.Object) error {
 }
 
 func (builder *CronJobBuilder) ShouldDeploy(resources []runtime.Object) bool {
-	return builder.Instance.Spec.PredictedTraffic != nil &&
-		status.IsPersistentVolumeClaimBound(resources) &&
-		status.IsJobCompleted(resources)
+	return builder.Instance.Spec.PredictedTraffic != nil && builder.isMapAvailable(resources)
+}
+
+func (builder *CronJobBuilder) ShouldPrune(resources []runtime.Object) bool {
+	return builder.Instance.Spec.PredictedTraffic == nil
 }
@@ -0,0 +1,75 @@
+package resource_test
+
+import (
+	valhallav1alpha1 "github.com/itayankri/valhalla-operator/api/v1alpha1"
+	"github.com/itayankri/valhalla-operator/internal/resource"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("CronJob builder", func() {
+	var instance *valhallav1alpha1.Valhalla
+	var builder *resource.CronJobBuilder
+	BeforeEach(func() {
+		instance = &valhallav1alpha1.Valhalla{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test",
+				Namespace: "default",
+			},
+			Spec: valhallav1alpha1.ValhallaSpec{
+				PBFURL: "https://download.geofabrik.de/australia-oceania/marshall-islands-latest.osm.pbf",
+				PredictedTraffic: &valhallav1alpha1.PredictedTrafficSpec{
+					URL:      "https://example.com/traffic.tar",
+					Schedule: "0 * * * *",
+				},
+			},
+		}
+		builder = (&resource.ValhallaResourceBuilder{Instance: instance, Scheme: scheme}).CronJob()
+	})
+
+	Context("ShouldDeploy", func() {
+		It("Should return 'false' when the map is not available yet", func() {
+			resources := generateChildResources(true, false)
+			Expect(builder.ShouldDeploy(resources)).To(Equal(false))
+		})
+
+		It("Should return 'true' when the map is available", func() {
+			resources := generateChildResources(true, true)
+			Expect(builder.ShouldDeploy(resources)).To(Equal(true))
+		})
+
+		It("Should return 'false' when predicted traffic is not configured", func() {
+			instance.Spec.PredictedTraffic = nil
+			resources := generateChildResources(true, true)
+			Expect(builder.ShouldDeploy(resources)).To(Equal(false))
+		})
+	})
+
+	Context("Update", func() {
+		It("Should suspend the CronJob while predicted traffic is paused", func() {
+			object, err := builder.Build()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(builder.Update(object)).To(Succeed())
+			Expect(*object.(*batchv1.CronJob).Spec.Suspend).To(BeFalse())
+
+			instance.Annotations = map[string]string{valhallav1alpha1.PredictedTrafficPausedAnnotation: "true"}
+			Expect(builder.Update(object)).To(Succeed())
+			Expect(*object.(*batchv1.CronJob).Spec.Suspend).To(BeTrue())
+		})
+	})
+
+	Context("ShouldPrune", func() {
+		It("Should return 'false' while the map is not available yet", func() {
+			resources := generateChildResources(false, false)
+			Expect(builder.ShouldPrune(resources)).To(Equal(false))
+		})
+
+		It("Should return 'true' when predicted traffic is removed from the spec", func() {
+			instance.Spec.PredictedTraffic = nil
+			resources := generateChildResources(true, true)
+			Expect(builder.ShouldPrune(resources)).To(Equal(true))
+		})
+	})
+})
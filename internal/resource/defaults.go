@@ -0,0 +1,215 @@
+package resource
+
+import (
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// The builders set the fields the API server would otherwise default, so that an unchanged
+// resource compares equal to the stored one and is not updated on every reconciliation.
+// The defaults below mirror the ones of the Kubernetes API server.
+
+const defaultFileMode int32 = 0644
+
+func withDeploymentDefaults(spec appsv1.DeploymentSpec) appsv1.DeploymentSpec {
+	if spec.Replicas == nil {
+		replicas := int32(1)
+		spec.Replicas = &replicas
+	}
+	if spec.Strategy.Type == "" {
+		spec.Strategy.Type = appsv1.RollingUpdateDeploymentStrategyType
+	}
+	if spec.Strategy.Type == appsv1.RollingUpdateDeploymentStrategyType && spec.Strategy.RollingUpdate == nil {
+		maxUnavailable := intstr.FromString("25%")
+		maxSurge := intstr.FromString("25%")
+		spec.Strategy.RollingUpdate = &appsv1.RollingUpdateDeployment{
+			MaxUnavailable: &maxUnavailable,
+			MaxSurge:       &maxSurge,
+		}
+	}
+	if spec.RevisionHistoryLimit == nil {
+		revisionHistoryLimit := int32(10)
+		spec.RevisionHistoryLimit = &revisionHistoryLimit
+	}
+	if spec.ProgressDeadlineSeconds == nil {
+		progressDeadlineSeconds := int32(600)
+		spec.ProgressDeadlineSeconds = &progressDeadlineSeconds
+	}
+	spec.Template.Spec = withPodSpecDefaults(spec.Template.Spec)
+	return spec
+}
+
+func withCronJobDefaults(spec batchv1.CronJobSpec) batchv1.CronJobSpec {
+	if spec.ConcurrencyPolicy == "" {
+		spec.ConcurrencyPolicy = batchv1.AllowConcurrent
+	}
+	if spec.Suspend == nil {
+		suspend := false
+		spec.Suspend = &suspend
+	}
+	if spec.SuccessfulJobsHistoryLimit == nil {
+		successfulJobsHistoryLimit := int32(3)
+		spec.SuccessfulJobsHistoryLimit = &successfulJobsHistoryLimit
+	}
+	if spec.FailedJobsHistoryLimit == nil {
+		failedJobsHistoryLimit := int32(1)
+		spec.FailedJobsHistoryLimit = &failedJobsHistoryLimit
+	}
+	spec.JobTemplate.Spec.Template.Spec = withPodSpecDefaults(spec.JobTemplate.Spec.Template.Spec)
+	return spec
+}
+
+// withHPABehaviorDefaults fills the scaling rules left out of a given behavior.
+// A behavior that is not given at all is not defaulted by the API server.
+func withHPABehaviorDefaults(behavior *autoscalingv2.HorizontalPodAutoscalerBehavior) *autoscalingv2.HorizontalPodAutoscalerBehavior {
+	if behavior == nil {
+		return nil
+	}
+	behavior = behavior.DeepCopy()
+	stabilizationWindowSeconds := int32(0)
+	behavior.ScaleUp = withHPAScalingRulesDefaults(behavior.ScaleUp, autoscalingv2.HPAScalingRules{
+		StabilizationWindowSeconds: &stabilizationWindowSeconds,
+		Policies: []autoscalingv2.HPAScalingPolicy{
+			{Type: autoscalingv2.PodsScalingPolicy, Value: 4, PeriodSeconds: 15},
+			{Type: autoscalingv2.PercentScalingPolicy, Value: 100, PeriodSeconds: 15},
+		},
+	})
+	behavior.ScaleDown = withHPAScalingRulesDefaults(behavior.ScaleDown, autoscalingv2.HPAScalingRules{
+		Policies: []autoscalingv2.HPAScalingPolicy{
+			{Type: autoscalingv2.PercentScalingPolicy, Value: 100, PeriodSeconds: 15},
+		},
+	})
+	return behavior
+}
+
+func withHPAScalingRulesDefaults(rules *autoscalingv2.HPAScalingRules, defaults autoscalingv2.HPAScalingRules) *autoscalingv2.HPAScalingRules {
+	if rules == nil {
+		rules = &autoscalingv2.HPAScalingRules{}
+	}
+	if rules.StabilizationWindowSeconds == nil {
+		rules.StabilizationWindowSeconds = defaults.StabilizationWindowSeconds
+	}
+	if rules.SelectPolicy == nil {
+		selectPolicy := autoscalingv2.MaxChangePolicySelect
+		rules.SelectPolicy = &selectPolicy
+	}
+	if rules.Policies == nil {
+		rules.Policies = defaults.Policies
+	}
+	return rules
+}
+
+// withPodSpecDefaults returns a copy of the pod spec with the defaults of the API server,
+// leaving the objects referenced from the instance spec untouched.
+func withPodSpecDefaults(spec corev1.PodSpec) corev1.PodSpec {
+	spec = *spec.DeepCopy()
+	if spec.RestartPolicy == "" {
+		spec.RestartPolicy = corev1.RestartPolicyAlways
+	}
+	if spec.TerminationGracePeriodSeconds == nil {
+		terminationGracePeriodSeconds := int64(corev1.DefaultTerminationGracePeriodSeconds)
+		spec.TerminationGracePeriodSeconds = &terminationGracePeriodSeconds
+	}
+	if spec.DNSPolicy == "" {
+		spec.DNSPolicy = corev1.DNSClusterFirst
+	}
+	if spec.SecurityContext == nil {
+		spec.SecurityContext = &corev1.PodSecurityContext{}
+	}
+	if spec.SchedulerName == "" {
+		spec.SchedulerName = corev1.DefaultSchedulerName
+	}
+	if spec.DeprecatedServiceAccount == "" {
+		spec.DeprecatedServiceAccount = spec.ServiceAccountName
+	}
+	for i := range spec.InitContainers {
+		setContainerDefaults(&spec.InitContainers[i])
+	}
+	for i := range spec.Containers {
+		setContainerDefaults(&spec.Containers[i])
+	}
+	for i := range spec.Volumes {
+		setVolumeDefaults(&spec.Volumes[i])
+	}
+	return spec
+}
+
+func setContainerDefaults(container *corev1.Container) {
+	if container.ImagePullPolicy == "" {
+		container.ImagePullPolicy = defaultImagePullPolicy(container.Image)
+	}
+	if container.TerminationMessagePath == "" {
+		container.TerminationMessagePath = corev1.TerminationMessagePathDefault
+	}
+	if container.TerminationMessagePolicy == "" {
+		container.TerminationMessagePolicy = corev1.TerminationMessageReadFile
+	}
+	for i := range container.Ports {
+		if container.Ports[i].Protocol == "" {
+			container.Ports[i].Protocol = corev1.ProtocolTCP
+		}
+	}
+	for _, env := range container.Env {
+		if env.ValueFrom != nil && env.ValueFrom.FieldRef != nil && env.ValueFrom.FieldRef.APIVersion == "" {
+			env.ValueFrom.FieldRef.APIVersion = "v1"
+		}
+	}
+	for _, probe := range []*corev1.Probe{container.ReadinessProbe, container.LivenessProbe, container.StartupProbe} {
+		if probe != nil {
+			setProbeDefaults(probe)
+		}
+	}
+}
+
+// defaultImagePullPolicy always pulls images tagged 'latest' or not tagged at all.
+func defaultImagePullPolicy(image string) corev1.PullPolicy {
+	if strings.Contains(image, "@") {
+		return corev1.PullIfNotPresent
+	}
+	name := image[strings.LastIndex(image, "/")+1:]
+	if tag := strings.LastIndex(name, ":"); tag == -1 || name[tag+1:] == "latest" {
+		return corev1.PullAlways
+	}
+	return corev1.PullIfNotPresent
+}
+
+func setProbeDefaults(probe *corev1.Probe) {
+	if probe.TimeoutSeconds == 0 {
+		probe.TimeoutSeconds = 1
+	}
+	if probe.PeriodSeconds == 0 {
+		probe.PeriodSeconds = 10
+	}
+	if probe.SuccessThreshold == 0 {
+		probe.SuccessThreshold = 1
+	}
+	if probe.FailureThreshold == 0 {
+		probe.FailureThreshold = 3
+	}
+	if probe.HTTPGet != nil && probe.HTTPGet.Scheme == "" {
+		probe.HTTPGet.Scheme = corev1.URISchemeHTTP
+	}
+	if probe.GRPC != nil && probe.GRPC.Service == nil {
+		service := ""
+		probe.GRPC.Service = &service
+	}
+}
+
+func setVolumeDefaults(volume *corev1.Volume) {
+	defaultMode := defaultFileMode
+	switch {
+	case volume.ConfigMap != nil && volume.ConfigMap.DefaultMode == nil:
+		volume.ConfigMap.DefaultMode = &defaultMode
+	case volume.Secret != nil && volume.Secret.DefaultMode == nil:
+		volume.Secret.DefaultMode = &defaultMode
+	case volume.Projected != nil && volume.Projected.DefaultMode == nil:
+		volume.Projected.DefaultMode = &defaultMode
+	case volume.DownwardAPI != nil && volume.DownwardAPI.DefaultMode == nil:
+		volume.DownwardAPI.DefaultMode = &defaultMode
+	}
+}
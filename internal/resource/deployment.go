@@ -1,13 +1,19 @@
 package resource
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"path"
+	"sort"
+	"time"
 
-	"github.com/itayankri/valhalla-operator/internal/status"
+	valhallav1alpha1 "github.com/itayankri/valhalla-operator/api/v1alpha1"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
@@ -33,8 +39,15 @@ func (builder *DeploymentBuilder) Update(object client.Object) error {
 	name := builder.Instance.ChildResourceName(DeploymentSuffix)
 	deployment := object.(*appsv1.Deployment)
 
-	deployment.Spec = appsv1.DeploymentSpec{
-		Replicas: builder.Instance.Spec.MinReplicas,
+	configHash, err := configHash(builder.Instance.Spec.Config)
+	if err != nil {
+		return err
+	}
+
+	deployment.Spec = withDeploymentDefaults(appsv1.DeploymentSpec{
+		Replicas: builder.replicas(deployment.Spec.Replicas),
+		// A Deployment created paused would never start its workers, so only existing ones are paused.
+		Paused: !deployment.CreationTimestamp.IsZero() && builder.Instance.IsPaused(valhallav1alpha1.WorkersPausedAnnotation),
 		Selector: &metav1.LabelSelector{
 			MatchLabels: map[string]string{
 				"app": name,
@@ -42,61 +55,229 @@ func (builder *DeploymentBuilder) Update(object client.Object) error {
 		},
 		Template: corev1.PodTemplateSpec{
 			ObjectMeta: metav1.ObjectMeta{
-				Labels: map[string]string{
-					"app": name,
-				},
+				Labels:      builder.podLabels(),
+				Annotations: builder.podAnnotations(configHash),
 			},
-			Spec: corev1.PodSpec{
-				Containers: []corev1.Container{
+			Spec: builder.podSpec(),
+		},
+	})
+
+	if err := controllerutil.SetControllerReference(builder.Instance, deployment, builder.Scheme); err != nil {
+		return fmt.Errorf("failed setting controller reference: %v", err)
+	}
+
+	return nil
+}
+
+func (builder *DeploymentBuilder) ShouldDeploy(resources []runtime.Object) bool {
+	return builder.isMapAvailable(resources)
+}
+
+// SecretNames returns the names of the Secrets the worker pods reference in their
+// environment or volumes, sorted and without duplicates.
+func (builder *DeploymentBuilder) SecretNames() []string {
+	podSpec := builder.podSpec()
+	names := map[string]bool{}
+	for _, container := range append(podSpec.InitContainers, podSpec.Containers...) {
+		for _, env := range container.Env {
+			if env.ValueFrom != nil && env.ValueFrom.SecretKeyRef != nil {
+				names[env.ValueFrom.SecretKeyRef.Name] = true
+			}
+		}
+		for _, envFrom := range container.EnvFrom {
+			if envFrom.SecretRef != nil {
+				names[envFrom.SecretRef.Name] = true
+			}
+		}
+	}
+	for _, volume := range podSpec.Volumes {
+		if volume.Secret != nil {
+			names[volume.Secret.SecretName] = true
+		}
+		if volume.Projected != nil {
+			for _, source := range volume.Projected.Sources {
+				if source.Secret != nil {
+					names[source.Secret.Name] = true
+				}
+			}
+		}
+	}
+
+	sortedNames := []string{}
+	for name := range names {
+		sortedNames = append(sortedNames, name)
+	}
+	sort.Strings(sortedNames)
+	return sortedNames
+}
+
+// replicas returns the replica count of the Deployment. When the workers are autoscaled,
+// the count set by the HorizontalPodAutoscaler on an existing Deployment is kept.
+func (builder *DeploymentBuilder) replicas(currentReplicas *int32) *int32 {
+	if !builder.Instance.Spec.IsAutoscalingEnabled() {
+		return builder.Instance.Spec.Replicas
+	}
+	if currentReplicas != nil {
+		return currentReplicas
+	}
+	minReplicas := builder.Instance.Spec.GetMinReplicas()
+	return &minReplicas
+}
+
+func (builder *DeploymentBuilder) podLabels() map[string]string {
+	labels := map[string]string{}
+	for key, value := range builder.Instance.Spec.GetWorkerPodTemplate().Labels {
+		labels[key] = value
+	}
+	labels["app"] = builder.Instance.ChildResourceName(DeploymentSuffix)
+	return labels
+}
+
+func (builder *DeploymentBuilder) podAnnotations(configHash string) map[string]string {
+	annotations := map[string]string{}
+	for key, value := range builder.Instance.Spec.GetWorkerPodTemplate().Annotations {
+		annotations[key] = value
+	}
+	// The workers read these inputs only when they start, so a change
+	// in any of them rolls out the pods.
+	annotations[ConfigHashAnnotation] = configHash
+	annotations[MapVersionAnnotation] = builder.servedMapVersion()
+	annotations[SecretsHashAnnotation] = secretsHash(builder.SecretNames(), builder.Secrets)
+	if restartTime := builder.Instance.Status.WorkersRestartTime; restartTime != nil {
+		annotations[RestartedAtAnnotation] = restartTime.UTC().Format(time.RFC3339)
+	}
+	return annotations
+}
+
+func (builder *DeploymentBuilder) podSpec() corev1.PodSpec {
+	name := builder.Instance.ChildResourceName(DeploymentSuffix)
+	podTemplate := builder.Instance.Spec.GetWorkerPodTemplate()
+	workers := builder.Instance.Spec.GetWorkers()
+	return corev1.PodSpec{
+		ImagePullSecrets:          builder.Instance.Spec.ImagePullSecrets,
+		NodeSelector:              podTemplate.NodeSelector,
+		Affinity:                  podTemplate.Affinity,
+		Tolerations:               podTemplate.Tolerations,
+		TopologySpreadConstraints: podTemplate.TopologySpreadConstraints,
+		PriorityClassName:         podTemplate.PriorityClassName,
+		ServiceAccountName:        podTemplate.ServiceAccountName,
+		SecurityContext:           podTemplate.SecurityContext,
+		Containers: []corev1.Container{
+			{
+				Name:            name,
+				Image:           imageOrDefault(builder.Instance.Spec.Image, workerImage),
+				ImagePullPolicy: builder.Instance.Spec.ImagePullPolicy,
+				SecurityContext: podTemplate.ContainerSecurityContext,
+				Ports: []corev1.ContainerPort{
 					{
-						Name:  name,
-						Image: workerImage,
-						Ports: []corev1.ContainerPort{
-							{
-								ContainerPort: containerPort,
-							},
-						},
-						Resources: *builder.Instance.Spec.GetResources(),
-						Env: []corev1.EnvVar{
-							{
-								Name:  "ROOT_DIR",
-								Value: valhallaDataPath,
-							},
-							{
-								Name:  "THREADS_PER_POD",
-								Value: fmt.Sprint(builder.Instance.Spec.GetThreadsPerPod()),
-							},
-						},
-						VolumeMounts: []corev1.VolumeMount{
-							{
-								Name:      name,
-								MountPath: valhallaDataPath,
-							},
-						},
+						ContainerPort: containerPort,
 					},
 				},
-				Volumes: []corev1.Volume{
+				Resources:      *builder.Instance.Spec.GetResources(),
+				ReadinessProbe: probeOrDefault(workers.ReadinessProbe, 10, 3),
+				LivenessProbe:  probeOrDefault(workers.LivenessProbe, 20, 3),
+				StartupProbe:   probeOrDefault(workers.StartupProbe, 10, 90),
+				Env: append([]corev1.EnvVar{
+					{
+						Name:  "ROOT_DIR",
+						Value: mapPath(builder.servedMapVersion()),
+					},
+					{
+						Name:  "THREADS_PER_POD",
+						Value: fmt.Sprint(builder.Instance.Spec.GetThreadsPerPod()),
+					},
 					{
-						Name: name,
-						VolumeSource: corev1.VolumeSource{
-							PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
-								ClaimName: name,
-								ReadOnly:  true,
-							},
+						Name:  "CONFIG_OVERLAY",
+						Value: path.Join(valhallaConfigPath, valhallaConfigFileName),
+					},
+				}, podTemplate.Env...),
+				EnvFrom: podTemplate.EnvFrom,
+				VolumeMounts: []corev1.VolumeMount{
+					{
+						Name:      name,
+						MountPath: valhallaDataPath,
+					},
+					{
+						Name:      configVolumeName,
+						MountPath: valhallaConfigPath,
+						ReadOnly:  true,
+					},
+				},
+			},
+		},
+		Volumes: []corev1.Volume{
+			{
+				Name: name,
+				VolumeSource: corev1.VolumeSource{
+					PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+						ClaimName: name,
+						ReadOnly:  true,
+					},
+				},
+			},
+			{
+				Name: configVolumeName,
+				VolumeSource: corev1.VolumeSource{
+					ConfigMap: &corev1.ConfigMapVolumeSource{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: builder.Instance.ChildResourceName(ConfigMapSuffix),
 						},
 					},
 				},
 			},
 		},
 	}
+}
 
-	if err := controllerutil.SetControllerReference(builder.Instance, deployment, builder.Scheme); err != nil {
-		return fmt.Errorf("failed setting controller reference: %v", err)
+// probeOrDefault returns the probe given in the instance spec, or an HTTP probe against
+// the /status endpoint of the worker, which responds once the tiles are loaded.
+func probeOrDefault(probe *corev1.Probe, periodSeconds int32, failureThreshold int32) *corev1.Probe {
+	if probe != nil {
+		return probe
+	}
+	return &corev1.Probe{
+		ProbeHandler: corev1.ProbeHandler{
+			HTTPGet: &corev1.HTTPGetAction{
+				Path: statusPath,
+				Port: intstr.FromInt(containerPort),
+			},
+		},
+		TimeoutSeconds:   5,
+		PeriodSeconds:    periodSeconds,
+		FailureThreshold: failureThreshold,
 	}
-
-	return nil
 }
 
-func (*DeploymentBuilder) ShouldDeploy(resources []runtime.Object) bool {
-	return status.IsPersistentVolumeClaimBound(resources) && status.IsJobCompleted(resources)
+// secretsHash returns a digest of the content of the referenced Secrets.
+// Secrets that do not exist yet only contribute their name.
+func secretsHash(names []string, secrets []corev1.Secret) string {
+	secretsByName := map[string]corev1.Secret{}
+	for _, secret := range secrets {
+		secretsByName[secret.Name] = secret
+	}
+
+	hash := sha256.New()
+	for _, name := range names {
+		fmt.Fprintf(hash, "%s\n", name)
+		secret, ok := secretsByName[name]
+		if !ok {
+			continue
+		}
+		keys := []string{}
+		for key := range secret.Data {
+			keys = append(keys, key)
+		}
+		for key := range secret.StringData {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			value, ok := secret.Data[key]
+			if !ok {
+				value = []byte(secret.StringData[key])
+			}
+			fmt.Fprintf(hash, "%s=%s\n", key, hex.EncodeToString(value))
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil))
 }
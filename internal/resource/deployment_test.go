@@ -1,9 +1,16 @@
 package resource_test
 
 import (
+	"time"
+
+	valhallav1alpha1 "github.com/itayankri/valhalla-operator/api/v1alpha1"
 	"github.com/itayankri/valhalla-operator/internal/resource"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 var _ = Describe("Deployment builder", func() {
@@ -32,5 +39,303 @@ var _ = Describe("Deployment builder", func() {
 			resources := generateChildResources(true, true)
 			Expect(builder.ShouldDeploy(resources)).To(Equal(true))
 		})
+
+		It("Should return 'true' while a new map version is being built and a previous one is served", func() {
+			valhallaResourceBuilder.Instance.Status.MapVersion = "00000000"
+			defer func() { valhallaResourceBuilder.Instance.Status.MapVersion = "" }()
+			resources := generateChildResources(true, false)
+			Expect(builder.ShouldDeploy(resources)).To(Equal(true))
+		})
+	})
+
+	Context("Update", func() {
+		var instance *valhallav1alpha1.Valhalla
+		var builder resource.ResourceBuilder
+		BeforeEach(func() {
+			instance = &valhallav1alpha1.Valhalla{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test",
+					Namespace: "default",
+				},
+			}
+			builder = (&resource.ValhallaResourceBuilder{Instance: instance, Scheme: scheme}).Deployment()
+		})
+
+		It("Should use the default worker image when no image is specified", func() {
+			object, err := builder.Build()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(builder.Update(object)).To(Succeed())
+
+			container := object.(*appsv1.Deployment).Spec.Template.Spec.Containers[0]
+			Expect(container.Image).To(Equal("itayankri/valhalla-worker:latest"))
+		})
+
+		It("Should use the image, pull policy and pull secrets from the instance spec", func() {
+			image := "registry.example.com/valhalla-worker:3.4.0"
+			instance.Spec.Image = &image
+			instance.Spec.ImagePullPolicy = corev1.PullAlways
+			instance.Spec.ImagePullSecrets = []corev1.LocalObjectReference{{Name: "registry-credentials"}}
+			object, err := builder.Build()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(builder.Update(object)).To(Succeed())
+
+			podSpec := object.(*appsv1.Deployment).Spec.Template.Spec
+			Expect(podSpec.Containers[0].Image).To(Equal(image))
+			Expect(podSpec.Containers[0].ImagePullPolicy).To(Equal(corev1.PullAlways))
+			Expect(podSpec.ImagePullSecrets).To(Equal(instance.Spec.ImagePullSecrets))
+		})
+
+		It("Should mount the rendered config into the workers", func() {
+			object, err := builder.Build()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(builder.Update(object)).To(Succeed())
+
+			podSpec := object.(*appsv1.Deployment).Spec.Template.Spec
+			Expect(podSpec.Containers[0].Env).To(ContainElement(corev1.EnvVar{
+				Name:  "CONFIG_OVERLAY",
+				Value: "/etc/valhalla/valhalla.json",
+			}))
+			Expect(podSpec.Volumes).To(ContainElement(WithTransform(func(volume corev1.Volume) string {
+				if volume.ConfigMap == nil {
+					return ""
+				}
+				return volume.ConfigMap.Name
+			}, Equal("test-config"))))
+		})
+
+		It("Should change the config hash of the pod template when the config changes", func() {
+			object, err := builder.Build()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(builder.Update(object)).To(Succeed())
+			oldHash := object.(*appsv1.Deployment).Spec.Template.Annotations[resource.ConfigHashAnnotation]
+			Expect(oldHash).NotTo(BeEmpty())
+
+			timeoutSeconds := int32(10)
+			instance.Spec.Config = &valhallav1alpha1.ConfigSpec{TimeoutSeconds: &timeoutSeconds}
+			Expect(builder.Update(object)).To(Succeed())
+			Expect(object.(*appsv1.Deployment).Spec.Template.Annotations).NotTo(HaveKeyWithValue(resource.ConfigHashAnnotation, oldHash))
+		})
+
+		It("Should change the secrets hash of the pod template when a referenced Secret changes", func() {
+			instance.Spec.Workers = &valhallav1alpha1.WorkersSpec{
+				PodTemplate: &valhallav1alpha1.WorkerPodTemplateSpec{
+					EnvFrom: []corev1.EnvFromSource{
+						{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "credentials"}}},
+					},
+				},
+			}
+			secrets := []corev1.Secret{
+				{ObjectMeta: metav1.ObjectMeta{Name: "credentials"}, Data: map[string][]byte{"token": []byte("old")}},
+			}
+			builder = (&resource.ValhallaResourceBuilder{Instance: instance, Scheme: scheme, Secrets: secrets}).Deployment()
+			object, err := builder.Build()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(builder.Update(object)).To(Succeed())
+			oldHash := object.(*appsv1.Deployment).Spec.Template.Annotations[resource.SecretsHashAnnotation]
+			Expect(oldHash).NotTo(BeEmpty())
+
+			Expect(builder.Update(object)).To(Succeed())
+			Expect(object.(*appsv1.Deployment).Spec.Template.Annotations).To(HaveKeyWithValue(resource.SecretsHashAnnotation, oldHash))
+
+			secrets[0].Data["token"] = []byte("new")
+			Expect(builder.Update(object)).To(Succeed())
+			Expect(object.(*appsv1.Deployment).Spec.Template.Annotations).NotTo(HaveKeyWithValue(resource.SecretsHashAnnotation, oldHash))
+		})
+
+		It("Should change the map version of the pod template when a new map version is served", func() {
+			instance.Status.MapVersion = "00000000"
+			object, err := builder.Build()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(builder.Update(object)).To(Succeed())
+			Expect(object.(*appsv1.Deployment).Spec.Template.Annotations).To(HaveKeyWithValue(resource.MapVersionAnnotation, "00000000"))
+
+			instance.Status.MapVersion = "11111111"
+			Expect(builder.Update(object)).To(Succeed())
+			Expect(object.(*appsv1.Deployment).Spec.Template.Annotations).To(HaveKeyWithValue(resource.MapVersionAnnotation, "11111111"))
+		})
+
+		It("Should restart the workers when a restart is requested", func() {
+			object, err := builder.Build()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(builder.Update(object)).To(Succeed())
+			Expect(object.(*appsv1.Deployment).Spec.Template.Annotations).NotTo(HaveKey(resource.RestartedAtAnnotation))
+
+			instance.Status.WorkersRestartTime = &metav1.Time{Time: time.Date(2023, time.March, 1, 12, 0, 0, 0, time.UTC)}
+			Expect(builder.Update(object)).To(Succeed())
+			Expect(object.(*appsv1.Deployment).Spec.Template.Annotations).To(HaveKeyWithValue(resource.RestartedAtAnnotation, "2023-03-01T12:00:00Z"))
+		})
+
+		It("Should pause the rollouts of an existing Deployment while the workers are paused", func() {
+			instance.Annotations = map[string]string{valhallav1alpha1.WorkersPausedAnnotation: "true"}
+			object, err := builder.Build()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(builder.Update(object)).To(Succeed())
+			Expect(object.(*appsv1.Deployment).Spec.Paused).To(BeFalse())
+
+			object.SetCreationTimestamp(metav1.Now())
+			Expect(builder.Update(object)).To(Succeed())
+			Expect(object.(*appsv1.Deployment).Spec.Paused).To(BeTrue())
+		})
+
+		It("Should not reference any Secrets by default", func() {
+			Expect(builder.(*resource.DeploymentBuilder).SecretNames()).To(BeEmpty())
+		})
+
+		It("Should apply the pod template overrides from the instance spec", func() {
+			runAsNonRoot := true
+			instance.Spec.Workers = &valhallav1alpha1.WorkersSpec{
+				PodTemplate: &valhallav1alpha1.WorkerPodTemplateSpec{
+					Labels:       map[string]string{"team": "routing", "app": "other"},
+					Annotations:  map[string]string{"example.com/owner": "routing"},
+					NodeSelector: map[string]string{"pool": "workers"},
+					Tolerations: []corev1.Toleration{
+						{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "valhalla", Effect: corev1.TaintEffectNoSchedule},
+					},
+					TopologySpreadConstraints: []corev1.TopologySpreadConstraint{
+						{MaxSkew: 1, TopologyKey: "topology.kubernetes.io/zone", WhenUnsatisfiable: corev1.ScheduleAnyway},
+					},
+					PriorityClassName:  "high-priority",
+					ServiceAccountName: "valhalla",
+					SecurityContext:    &corev1.PodSecurityContext{RunAsNonRoot: &runAsNonRoot},
+					ContainerSecurityContext: &corev1.SecurityContext{
+						Capabilities: &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+					},
+					Env: []corev1.EnvVar{{Name: "LOG_LEVEL", Value: "debug"}},
+				},
+			}
+			object, err := builder.Build()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(builder.Update(object)).To(Succeed())
+
+			template := object.(*appsv1.Deployment).Spec.Template
+			Expect(template.Labels).To(HaveKeyWithValue("team", "routing"))
+			Expect(template.Labels).To(HaveKeyWithValue("app", "test"))
+			Expect(template.Annotations).To(HaveKeyWithValue("example.com/owner", "routing"))
+			Expect(template.Annotations).To(HaveKey(resource.ConfigHashAnnotation))
+			Expect(template.Spec.NodeSelector).To(Equal(instance.Spec.Workers.PodTemplate.NodeSelector))
+			Expect(template.Spec.Tolerations).To(Equal(instance.Spec.Workers.PodTemplate.Tolerations))
+			Expect(template.Spec.TopologySpreadConstraints).To(Equal(instance.Spec.Workers.PodTemplate.TopologySpreadConstraints))
+			Expect(template.Spec.PriorityClassName).To(Equal("high-priority"))
+			Expect(template.Spec.ServiceAccountName).To(Equal("valhalla"))
+			Expect(template.Spec.SecurityContext).To(Equal(instance.Spec.Workers.PodTemplate.SecurityContext))
+			Expect(template.Spec.Containers[0].SecurityContext).To(Equal(instance.Spec.Workers.PodTemplate.ContainerSecurityContext))
+			Expect(template.Spec.Containers[0].Env).To(ContainElement(corev1.EnvVar{Name: "LOG_LEVEL", Value: "debug"}))
+			Expect(template.Spec.Containers[0].Env).To(ContainElement(WithTransform(func(env corev1.EnvVar) string { return env.Name }, Equal("ROOT_DIR"))))
+		})
+
+		It("Should create the Deployment with minReplicas when the workers are autoscaled", func() {
+			minReplicas := int32(2)
+			instance.Spec.MinReplicas = &minReplicas
+			object, err := builder.Build()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(builder.Update(object)).To(Succeed())
+			Expect(*object.(*appsv1.Deployment).Spec.Replicas).To(Equal(int32(2)))
+		})
+
+		It("Should keep the replicas set by the HorizontalPodAutoscaler", func() {
+			object, err := builder.Build()
+			Expect(err).NotTo(HaveOccurred())
+			currentReplicas := int32(4)
+			object.(*appsv1.Deployment).Spec.Replicas = &currentReplicas
+			Expect(builder.Update(object)).To(Succeed())
+			Expect(*object.(*appsv1.Deployment).Spec.Replicas).To(Equal(int32(4)))
+		})
+
+		It("Should use the fixed number of replicas from the instance spec", func() {
+			replicas := int32(1)
+			instance.Spec.Replicas = &replicas
+			object, err := builder.Build()
+			Expect(err).NotTo(HaveOccurred())
+			currentReplicas := int32(4)
+			object.(*appsv1.Deployment).Spec.Replicas = &currentReplicas
+			Expect(builder.Update(object)).To(Succeed())
+			Expect(*object.(*appsv1.Deployment).Spec.Replicas).To(Equal(int32(1)))
+		})
+
+		It("Should probe the /status endpoint of the workers by default", func() {
+			object, err := builder.Build()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(builder.Update(object)).To(Succeed())
+
+			container := object.(*appsv1.Deployment).Spec.Template.Spec.Containers[0]
+			for _, probe := range []*corev1.Probe{container.ReadinessProbe, container.LivenessProbe, container.StartupProbe} {
+				Expect(probe).NotTo(BeNil())
+				Expect(probe.HTTPGet.Path).To(Equal("/status"))
+				Expect(probe.HTTPGet.Port).To(Equal(intstr.FromInt(8002)))
+			}
+			Expect(container.StartupProbe.PeriodSeconds * container.StartupProbe.FailureThreshold).To(BeNumerically(">=", 600))
+		})
+
+		It("Should set the fields defaulted by the API server", func() {
+			object, err := builder.Build()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(builder.Update(object)).To(Succeed())
+
+			deployment := object.(*appsv1.Deployment)
+			Expect(deployment.Spec.Strategy.Type).To(Equal(appsv1.RollingUpdateDeploymentStrategyType))
+			Expect(*deployment.Spec.RevisionHistoryLimit).To(Equal(int32(10)))
+			Expect(*deployment.Spec.ProgressDeadlineSeconds).To(Equal(int32(600)))
+
+			podSpec := deployment.Spec.Template.Spec
+			Expect(podSpec.RestartPolicy).To(Equal(corev1.RestartPolicyAlways))
+			Expect(podSpec.DNSPolicy).To(Equal(corev1.DNSClusterFirst))
+			Expect(podSpec.SchedulerName).To(Equal(corev1.DefaultSchedulerName))
+			Expect(podSpec.SecurityContext).NotTo(BeNil())
+			Expect(*podSpec.Volumes[1].ConfigMap.DefaultMode).To(Equal(int32(0644)))
+
+			container := podSpec.Containers[0]
+			Expect(container.ImagePullPolicy).To(Equal(corev1.PullAlways))
+			Expect(container.TerminationMessagePath).To(Equal(corev1.TerminationMessagePathDefault))
+			Expect(container.Ports[0].Protocol).To(Equal(corev1.ProtocolTCP))
+			Expect(container.ReadinessProbe.HTTPGet.Scheme).To(Equal(corev1.URISchemeHTTP))
+			Expect(container.ReadinessProbe.SuccessThreshold).To(Equal(int32(1)))
+		})
+
+		It("Should use the probes from the instance spec", func() {
+			startupProbe := &corev1.Probe{
+				ProbeHandler: corev1.ProbeHandler{
+					TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromInt(8002)},
+				},
+				FailureThreshold: 360,
+			}
+			instance.Spec.Workers = &valhallav1alpha1.WorkersSpec{StartupProbe: startupProbe}
+			object, err := builder.Build()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(builder.Update(object)).To(Succeed())
+
+			container := object.(*appsv1.Deployment).Spec.Template.Spec.Containers[0]
+			Expect(container.StartupProbe.TCPSocket).To(Equal(startupProbe.TCPSocket))
+			Expect(container.StartupProbe.FailureThreshold).To(Equal(int32(360)))
+			Expect(startupProbe.PeriodSeconds).To(BeZero())
+			Expect(container.ReadinessProbe.HTTPGet.Path).To(Equal("/status"))
+		})
+
+		Context("Secrets", func() {
+			BeforeEach(func() {
+				instance.Spec.Workers = &valhallav1alpha1.WorkersSpec{
+					PodTemplate: &valhallav1alpha1.WorkerPodTemplateSpec{
+						Env: []corev1.EnvVar{
+							{
+								Name: "API_KEY",
+								ValueFrom: &corev1.EnvVarSource{
+									SecretKeyRef: &corev1.SecretKeySelector{
+										LocalObjectReference: corev1.LocalObjectReference{Name: "api-key"},
+										Key:                  "key",
+									},
+								},
+							},
+						},
+						EnvFrom: []corev1.EnvFromSource{
+							{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "credentials"}}},
+							{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "api-key"}}},
+						},
+					},
+				}
+			})
+
+			It("Should return the Secrets referenced by the workers", func() {
+				Expect(builder.(*resource.DeploymentBuilder).SecretNames()).To(Equal([]string{"api-key", "credentials"}))
+			})
+		})
 	})
 })
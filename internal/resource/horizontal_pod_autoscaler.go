@@ -2,9 +2,13 @@ package resource
 
 import (
 	"fmt"
+	"time"
 
-	"github.com/itayankri/valhalla-operator/internal/status"
-	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	valhallav1alpha1 "github.com/itayankri/valhalla-operator/api/v1alpha1"
+	"github.com/robfig/cron/v3"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -20,7 +24,7 @@ func (builder *ValhallaResourceBuilder) HorizontalPodAutoscaler() *HorizontalPod
 }
 
 func (builder *HorizontalPodAutoscalerBuilder) Build() (client.Object, error) {
-	return &autoscalingv1.HorizontalPodAutoscaler{
+	return &autoscalingv2.HorizontalPodAutoscaler{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      builder.Instance.ChildResourceName(HorizontalPodAutoscalerSuffix),
 			Namespace: builder.Instance.Namespace,
@@ -30,18 +34,27 @@ func (builder *HorizontalPodAutoscalerBuilder) Build() (client.Object, error) {
 
 func (builder *HorizontalPodAutoscalerBuilder) Update(object client.Object) error {
 	name := builder.Instance.ChildResourceName(HorizontalPodAutoscalerSuffix)
-	hpa := object.(*autoscalingv1.HorizontalPodAutoscaler)
-
-	targetCPUUtilizationPercentage := int32(85)
+	hpa := object.(*autoscalingv2.HorizontalPodAutoscaler)
+	autoscaling := builder.Instance.Spec.GetAutoscaling()
 
-	hpa.Spec.ScaleTargetRef = autoscalingv1.CrossVersionObjectReference{
+	hpa.Spec.ScaleTargetRef = autoscalingv2.CrossVersionObjectReference{
 		Kind:       "Deployment",
 		Name:       name,
 		APIVersion: "apps/v1",
 	}
-	hpa.Spec.MinReplicas = builder.Instance.Spec.MinReplicas
-	hpa.Spec.MaxReplicas = *builder.Instance.Spec.MaxReplicas
-	hpa.Spec.TargetCPUUtilizationPercentage = &targetCPUUtilizationPercentage
+	minReplicas, maxReplicas := builder.replicaBounds()
+	hpa.Spec.MinReplicas = &minReplicas
+	hpa.Spec.MaxReplicas = maxReplicas
+
+	hpa.Spec.Metrics = []autoscalingv2.MetricSpec{
+		resourceUtilizationMetric(corev1.ResourceCPU, autoscaling.GetTargetCPUUtilizationPercentage()),
+	}
+	if autoscaling.TargetMemoryUtilizationPercentage != nil {
+		hpa.Spec.Metrics = append(hpa.Spec.Metrics,
+			resourceUtilizationMetric(corev1.ResourceMemory, *autoscaling.TargetMemoryUtilizationPercentage))
+	}
+	hpa.Spec.Metrics = append(hpa.Spec.Metrics, autoscaling.Metrics...)
+	hpa.Spec.Behavior = withHPABehaviorDefaults(autoscaling.Behavior)
 
 	if err := controllerutil.SetControllerReference(builder.Instance, hpa, builder.Scheme); err != nil {
 		return fmt.Errorf("failed setting controller reference: %v", err)
@@ -50,6 +63,75 @@ func (builder *HorizontalPodAutoscalerBuilder) Update(object client.Object) erro
 	return nil
 }
 
-func (*HorizontalPodAutoscalerBuilder) ShouldDeploy(resources []runtime.Object) bool {
-	return status.IsPersistentVolumeClaimBound(resources) && status.IsJobCompleted(resources)
+func (builder *HorizontalPodAutoscalerBuilder) ShouldDeploy(resources []runtime.Object) bool {
+	return builder.Instance.Spec.IsAutoscalingEnabled() && builder.isMapAvailable(resources)
+}
+
+func (builder *HorizontalPodAutoscalerBuilder) ShouldPrune(resources []runtime.Object) bool {
+	return !builder.Instance.Spec.IsAutoscalingEnabled()
+}
+
+// replicaBounds returns minReplicas and maxReplicas, overridden by the active scaling window.
+// maxReplicas is raised to minReplicas when the window only raises the lower bound above it.
+func (builder *HorizontalPodAutoscalerBuilder) replicaBounds() (int32, int32) {
+	minReplicas := builder.Instance.Spec.GetMinReplicas()
+	maxReplicas := builder.Instance.Spec.GetMaxReplicas()
+	if window := builder.ScalingWindow; window != nil {
+		if window.MinReplicas != nil {
+			minReplicas = *window.MinReplicas
+		}
+		if window.MaxReplicas != nil {
+			maxReplicas = *window.MaxReplicas
+		}
+	}
+	if maxReplicas < minReplicas {
+		maxReplicas = minReplicas
+	}
+	return minReplicas, maxReplicas
+}
+
+// ActiveScalingWindow returns the first window of the schedule that is active at the given time,
+// along with the time left until the next window starts or ends.
+func ActiveScalingWindow(windows []valhallav1alpha1.ScalingWindowSpec, now time.Time) (*valhallav1alpha1.ScalingWindowSpec, time.Duration, error) {
+	var activeWindow *valhallav1alpha1.ScalingWindowSpec
+	var nextBoundary time.Time
+	for i := range windows {
+		window := &windows[i]
+		schedule, err := cron.ParseStandard(window.Schedule)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to parse schedule of scaling window %d: %v", i, err)
+		}
+
+		boundary := schedule.Next(now)
+		// The window is active if it started less than its duration ago.
+		if start := schedule.Next(now.Add(-window.Duration.Duration)); !start.After(now) {
+			if activeWindow == nil {
+				activeWindow = window
+			}
+			if end := start.Add(window.Duration.Duration); end.Before(boundary) {
+				boundary = end
+			}
+		}
+		if nextBoundary.IsZero() || boundary.Before(nextBoundary) {
+			nextBoundary = boundary
+		}
+	}
+
+	if nextBoundary.IsZero() {
+		return activeWindow, 0, nil
+	}
+	return activeWindow, nextBoundary.Sub(now), nil
+}
+
+func resourceUtilizationMetric(resourceName corev1.ResourceName, averageUtilization int32) autoscalingv2.MetricSpec {
+	return autoscalingv2.MetricSpec{
+		Type: autoscalingv2.ResourceMetricSourceType,
+		Resource: &autoscalingv2.ResourceMetricSource{
+			Name: resourceName,
+			Target: autoscalingv2.MetricTarget{
+				Type:               autoscalingv2.UtilizationMetricType,
+				AverageUtilization: &averageUtilization,
+			},
+		},
+	}
 }
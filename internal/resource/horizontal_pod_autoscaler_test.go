@@ -1,9 +1,17 @@
 package resource_test
 
 import (
+	"time"
+
+	valhallav1alpha1 "github.com/itayankri/valhalla-operator/api/v1alpha1"
 	"github.com/itayankri/valhalla-operator/internal/resource"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	k8sresource "k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
 )
 
 var _ = Describe("HorizontalPodAutoscaler builder", func() {
@@ -33,4 +41,167 @@ var _ = Describe("HorizontalPodAutoscaler builder", func() {
 			Expect(builder.ShouldDeploy(resources)).To(Equal(true))
 		})
 	})
+
+	Context("Fixed replicas", func() {
+		var builder *resource.HorizontalPodAutoscalerBuilder
+		BeforeEach(func() {
+			instance := &valhallav1alpha1.Valhalla{
+				Spec: valhallav1alpha1.ValhallaSpec{
+					Replicas: pointer.Int32Ptr(1),
+				},
+			}
+			builder = (&resource.ValhallaResourceBuilder{Instance: instance, Scheme: scheme}).HorizontalPodAutoscaler()
+		})
+
+		It("Should not deploy a HorizontalPodAutoscaler", func() {
+			resources := generateChildResources(true, true)
+			Expect(builder.ShouldDeploy(resources)).To(Equal(false))
+		})
+
+		It("Should prune an existing HorizontalPodAutoscaler", func() {
+			resources := generateChildResources(true, true)
+			Expect(builder.ShouldPrune(resources)).To(Equal(true))
+		})
+	})
+
+	Context("Update", func() {
+		var instance *valhallav1alpha1.Valhalla
+		var builder resource.ResourceBuilder
+		BeforeEach(func() {
+			instance = &valhallav1alpha1.Valhalla{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test",
+					Namespace: "default",
+				},
+				Spec: valhallav1alpha1.ValhallaSpec{
+					MinReplicas: pointer.Int32Ptr(2),
+					MaxReplicas: pointer.Int32Ptr(5),
+				},
+			}
+			builder = (&resource.ValhallaResourceBuilder{Instance: instance, Scheme: scheme}).HorizontalPodAutoscaler()
+		})
+
+		update := func() *autoscalingv2.HorizontalPodAutoscaler {
+			object, err := builder.Build()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(builder.Update(object)).To(Succeed())
+			return object.(*autoscalingv2.HorizontalPodAutoscaler)
+		}
+
+		It("Should scale the workers on 85% CPU utilization by default", func() {
+			hpa := update()
+			Expect(*hpa.Spec.MinReplicas).To(Equal(int32(2)))
+			Expect(hpa.Spec.MaxReplicas).To(Equal(int32(5)))
+			Expect(hpa.Spec.Metrics).To(HaveLen(1))
+			Expect(hpa.Spec.Metrics[0].Resource.Name).To(Equal(corev1.ResourceCPU))
+			Expect(*hpa.Spec.Metrics[0].Resource.Target.AverageUtilization).To(Equal(int32(85)))
+			Expect(hpa.Spec.Behavior).To(BeNil())
+		})
+
+		It("Should use the metrics and behavior from the instance spec", func() {
+			stabilizationWindowSeconds := int32(300)
+			requestsPerSecond := autoscalingv2.MetricSpec{
+				Type: autoscalingv2.PodsMetricSourceType,
+				Pods: &autoscalingv2.PodsMetricSource{
+					Metric: autoscalingv2.MetricIdentifier{Name: "requests_per_second"},
+					Target: autoscalingv2.MetricTarget{
+						Type:         autoscalingv2.AverageValueMetricType,
+						AverageValue: k8sresource.NewQuantity(50, k8sresource.DecimalSI),
+					},
+				},
+			}
+			instance.Spec.Autoscaling = &valhallav1alpha1.AutoscalingSpec{
+				TargetCPUUtilizationPercentage:    pointer.Int32Ptr(60),
+				TargetMemoryUtilizationPercentage: pointer.Int32Ptr(75),
+				Metrics:                           []autoscalingv2.MetricSpec{requestsPerSecond},
+				Behavior: &autoscalingv2.HorizontalPodAutoscalerBehavior{
+					ScaleDown: &autoscalingv2.HPAScalingRules{StabilizationWindowSeconds: &stabilizationWindowSeconds},
+				},
+			}
+
+			hpa := update()
+			Expect(hpa.Spec.Metrics).To(HaveLen(3))
+			Expect(hpa.Spec.Metrics[0].Resource.Name).To(Equal(corev1.ResourceCPU))
+			Expect(*hpa.Spec.Metrics[0].Resource.Target.AverageUtilization).To(Equal(int32(60)))
+			Expect(hpa.Spec.Metrics[1].Resource.Name).To(Equal(corev1.ResourceMemory))
+			Expect(*hpa.Spec.Metrics[1].Resource.Target.AverageUtilization).To(Equal(int32(75)))
+			Expect(hpa.Spec.Metrics[2]).To(Equal(requestsPerSecond))
+			Expect(hpa.Spec.Behavior.ScaleDown.StabilizationWindowSeconds).To(Equal(&stabilizationWindowSeconds))
+			Expect(hpa.Spec.Behavior.ScaleUp).NotTo(BeNil())
+			Expect(instance.Spec.Autoscaling.Behavior.ScaleUp).To(BeNil())
+		})
+
+		It("Should override the replica bounds with the active scaling window", func() {
+			builder = (&resource.ValhallaResourceBuilder{
+				Instance: instance,
+				Scheme:   scheme,
+				ScalingWindow: &valhallav1alpha1.ScalingWindowSpec{
+					MinReplicas: pointer.Int32Ptr(8),
+				},
+			}).HorizontalPodAutoscaler()
+
+			hpa := update()
+			Expect(*hpa.Spec.MinReplicas).To(Equal(int32(8)))
+			Expect(hpa.Spec.MaxReplicas).To(Equal(int32(8)))
+		})
+	})
+
+	Context("ActiveScalingWindow", func() {
+		windows := []valhallav1alpha1.ScalingWindowSpec{
+			{
+				Name:        "morning-rush",
+				Schedule:    "0 7 * * *",
+				Duration:    metav1.Duration{Duration: 2 * time.Hour},
+				MinReplicas: pointer.Int32Ptr(6),
+			},
+			{
+				Name:        "night",
+				Schedule:    "0 23 * * *",
+				Duration:    metav1.Duration{Duration: 6 * time.Hour},
+				MaxReplicas: pointer.Int32Ptr(1),
+			},
+		}
+		at := func(hour, minute int) time.Time {
+			return time.Date(2023, time.March, 1, hour, minute, 0, 0, time.Local)
+		}
+
+		It("Should return no window and the time until the next window starts", func() {
+			window, requeueAfter, err := resource.ActiveScalingWindow(windows, at(12, 0))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(window).To(BeNil())
+			Expect(requeueAfter).To(Equal(11 * time.Hour))
+		})
+
+		It("Should return the active window and the time until it ends", func() {
+			window, requeueAfter, err := resource.ActiveScalingWindow(windows, at(8, 15))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(window.Name).To(Equal("morning-rush"))
+			Expect(requeueAfter).To(Equal(45 * time.Minute))
+		})
+
+		It("Should return a window that started on the previous day", func() {
+			window, requeueAfter, err := resource.ActiveScalingWindow(windows, at(2, 0))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(window.Name).To(Equal("night"))
+			Expect(requeueAfter).To(Equal(3 * time.Hour))
+		})
+
+		It("Should treat the start of a window as active", func() {
+			window, _, err := resource.ActiveScalingWindow(windows, at(7, 0))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(window.Name).To(Equal("morning-rush"))
+		})
+
+		It("Should not requeue without a scaling schedule", func() {
+			window, requeueAfter, err := resource.ActiveScalingWindow(nil, at(7, 0))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(window).To(BeNil())
+			Expect(requeueAfter).To(BeZero())
+		})
+
+		It("Should fail on a malformed schedule", func() {
+			_, _, err := resource.ActiveScalingWindow([]valhallav1alpha1.ScalingWindowSpec{{Schedule: "mornings"}}, at(7, 0))
+			Expect(err).To(HaveOccurred())
+		})
+	})
 })
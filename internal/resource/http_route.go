@@ -0,0 +1,110 @@
+package resource
+
+import (
+	"fmt"
+
+	"github.com/itayankri/valhalla-operator/internal/metadata"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// HTTPRouteGroupVersionKind is the Gateway API HTTPRoute. It is managed as an unstructured
+// object, so that the operator does not depend on the Gateway API CRDs being installed.
+var HTTPRouteGroupVersionKind = schema.GroupVersionKind{
+	Group:   "gateway.networking.k8s.io",
+	Version: "v1beta1",
+	Kind:    "HTTPRoute",
+}
+
+type HTTPRouteBuilder struct {
+	*ValhallaResourceBuilder
+}
+
+func (builder *ValhallaResourceBuilder) HTTPRoute() *HTTPRouteBuilder {
+	return &HTTPRouteBuilder{builder}
+}
+
+func (builder *HTTPRouteBuilder) Build() (client.Object, error) {
+	route := &unstructured.Unstructured{}
+	route.SetGroupVersionKind(HTTPRouteGroupVersionKind)
+	route.SetName(builder.Instance.ChildResourceName(HTTPRouteSuffix))
+	route.SetNamespace(builder.Instance.Namespace)
+	return route, nil
+}
+
+func (builder *HTTPRouteBuilder) Update(object client.Object) error {
+	route := object.(*unstructured.Unstructured)
+	spec := builder.Instance.Spec.HTTPRoute
+
+	parentRefs := []interface{}{}
+	for _, parentRef := range spec.ParentRefs {
+		ref := map[string]interface{}{
+			"group": HTTPRouteGroupVersionKind.Group,
+			"kind":  "Gateway",
+			"name":  parentRef.Name,
+		}
+		if parentRef.Namespace != "" {
+			ref["namespace"] = parentRef.Namespace
+		}
+		if parentRef.SectionName != "" {
+			ref["sectionName"] = parentRef.SectionName
+		}
+		parentRefs = append(parentRefs, ref)
+	}
+
+	// The group, kind and weight defaulted by the Gateway API CRD are set, so that an unchanged route is not updated.
+	routeSpec := map[string]interface{}{
+		"parentRefs": parentRefs,
+		"rules": []interface{}{
+			map[string]interface{}{
+				"matches": []interface{}{
+					map[string]interface{}{
+						"path": map[string]interface{}{
+							"type":  "PathPrefix",
+							"value": spec.GetPath(),
+						},
+					},
+				},
+				"backendRefs": []interface{}{
+					map[string]interface{}{
+						"group":  "",
+						"kind":   "Service",
+						"name":   builder.Instance.ChildResourceName(ServiceSuffix),
+						"port":   int64(servicePort),
+						"weight": int64(1),
+					},
+				},
+			},
+		},
+	}
+	if len(spec.Hostnames) > 0 {
+		hostnames := []interface{}{}
+		for _, hostname := range spec.Hostnames {
+			hostnames = append(hostnames, hostname)
+		}
+		routeSpec["hostnames"] = hostnames
+	}
+
+	if err := unstructured.SetNestedField(route.Object, routeSpec, "spec"); err != nil {
+		return fmt.Errorf("failed setting HTTPRoute spec: %v", err)
+	}
+
+	route.SetAnnotations(metadata.ReconcileManagedAnnotations(route.GetAnnotations(), spec.Annotations))
+
+	if err := controllerutil.SetControllerReference(builder.Instance, route, builder.Scheme); err != nil {
+		return fmt.Errorf("failed setting controller reference: %v", err)
+	}
+
+	return nil
+}
+
+func (builder *HTTPRouteBuilder) ShouldDeploy(resources []runtime.Object) bool {
+	return builder.Instance.Spec.HTTPRoute != nil && builder.isMapAvailable(resources)
+}
+
+func (builder *HTTPRouteBuilder) ShouldPrune(resources []runtime.Object) bool {
+	return builder.Instance.Spec.HTTPRoute == nil
+}
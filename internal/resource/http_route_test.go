@@ -0,0 +1,105 @@
+package resource_test
+
+import (
+	valhallav1alpha1 "github.com/itayankri/valhalla-operator/api/v1alpha1"
+	"github.com/itayankri/valhalla-operator/internal/metadata"
+	"github.com/itayankri/valhalla-operator/internal/resource"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+var _ = Describe("HTTPRoute builder", func() {
+	var instance *valhallav1alpha1.Valhalla
+	var builder *resource.HTTPRouteBuilder
+	BeforeEach(func() {
+		instance = &valhallav1alpha1.Valhalla{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test",
+				Namespace: "default",
+			},
+			Spec: valhallav1alpha1.ValhallaSpec{
+				HTTPRoute: &valhallav1alpha1.HTTPRouteSpec{
+					ParentRefs: []valhallav1alpha1.GatewayReference{
+						{Name: "public", Namespace: "gateways", SectionName: "https"},
+					},
+					Hostnames: []string{"routing.example.com"},
+				},
+			},
+		}
+		builder = (&resource.ValhallaResourceBuilder{Instance: instance, Scheme: scheme}).HTTPRoute()
+	})
+
+	Context("ShouldDeploy", func() {
+		It("Should return 'true' when the map is available", func() {
+			resources := generateChildResources(true, true)
+			Expect(builder.ShouldDeploy(resources)).To(Equal(true))
+			Expect(builder.ShouldPrune(resources)).To(Equal(false))
+		})
+
+		It("Should return 'false' and prune the HTTPRoute when it is not configured", func() {
+			instance.Spec.HTTPRoute = nil
+			resources := generateChildResources(true, true)
+			Expect(builder.ShouldDeploy(resources)).To(Equal(false))
+			Expect(builder.ShouldPrune(resources)).To(Equal(true))
+		})
+	})
+
+	Context("Update", func() {
+		It("Should route the hostnames to the Service of the workers", func() {
+			object, err := builder.Build()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(builder.Update(object)).To(Succeed())
+
+			route := object.(*unstructured.Unstructured)
+			Expect(route.GroupVersionKind()).To(Equal(resource.HTTPRouteGroupVersionKind))
+			Expect(route.GetName()).To(Equal("test"))
+			Expect(route.GetOwnerReferences()).To(HaveLen(1))
+
+			hostnames, _, err := unstructured.NestedStringSlice(route.Object, "spec", "hostnames")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(hostnames).To(Equal([]string{"routing.example.com"}))
+
+			parentRefs, _, err := unstructured.NestedSlice(route.Object, "spec", "parentRefs")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(parentRefs).To(Equal([]interface{}{
+				map[string]interface{}{
+					"group":       "gateway.networking.k8s.io",
+					"kind":        "Gateway",
+					"name":        "public",
+					"namespace":   "gateways",
+					"sectionName": "https",
+				},
+			}))
+
+			rules, _, err := unstructured.NestedSlice(route.Object, "spec", "rules")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(rules).To(HaveLen(1))
+			rule := rules[0].(map[string]interface{})
+			Expect(rule["backendRefs"]).To(Equal([]interface{}{
+				map[string]interface{}{"group": "", "kind": "Service", "name": "test", "port": int64(80), "weight": int64(1)},
+			}))
+			Expect(rule["matches"]).To(Equal([]interface{}{
+				map[string]interface{}{"path": map[string]interface{}{"type": "PathPrefix", "value": "/"}},
+			}))
+		})
+
+		It("Should replace the annotations from the spec and keep the ones added by other tools", func() {
+			instance.Spec.HTTPRoute.Annotations = map[string]string{"example.com/old": "true"}
+			object, err := builder.Build()
+			Expect(err).NotTo(HaveOccurred())
+			object.SetAnnotations(map[string]string{"example.com/added-by": "another-controller"})
+			Expect(builder.Update(object)).To(Succeed())
+			Expect(object.GetAnnotations()).To(HaveKeyWithValue("example.com/old", "true"))
+
+			instance.Spec.HTTPRoute.Annotations = map[string]string{"example.com/new": "true"}
+			Expect(builder.Update(object)).To(Succeed())
+			Expect(object.GetAnnotations()).To(Equal(map[string]string{
+				"example.com/added-by":                "another-controller",
+				"example.com/new":                     "true",
+				metadata.ManagedAnnotationsAnnotation: "example.com/new",
+			}))
+		})
+	})
+})
@@ -0,0 +1,86 @@
+package resource
+
+import (
+	"fmt"
+
+	"github.com/itayankri/valhalla-operator/internal/metadata"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+type IngressBuilder struct {
+	*ValhallaResourceBuilder
+}
+
+func (builder *ValhallaResourceBuilder) Ingress() *IngressBuilder {
+	return &IngressBuilder{builder}
+}
+
+func (builder *IngressBuilder) Build() (client.Object, error) {
+	return &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      builder.Instance.ChildResourceName(IngressSuffix),
+			Namespace: builder.Instance.Namespace,
+		},
+	}, nil
+}
+
+func (builder *IngressBuilder) Update(object client.Object) error {
+	ingress := object.(*networkingv1.Ingress)
+	spec := builder.Instance.Spec.Ingress
+	pathType := networkingv1.PathTypePrefix
+
+	ingress.Spec = networkingv1.IngressSpec{
+		IngressClassName: spec.IngressClassName,
+		Rules: []networkingv1.IngressRule{
+			{
+				Host: spec.Host,
+				IngressRuleValue: networkingv1.IngressRuleValue{
+					HTTP: &networkingv1.HTTPIngressRuleValue{
+						Paths: []networkingv1.HTTPIngressPath{
+							{
+								Path:     spec.GetPath(),
+								PathType: &pathType,
+								Backend: networkingv1.IngressBackend{
+									Service: &networkingv1.IngressServiceBackend{
+										Name: builder.Instance.ChildResourceName(ServiceSuffix),
+										Port: networkingv1.ServiceBackendPort{
+											Number: servicePort,
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	if spec.TLSSecretName != "" {
+		tls := networkingv1.IngressTLS{SecretName: spec.TLSSecretName}
+		if spec.Host != "" {
+			tls.Hosts = []string{spec.Host}
+		}
+		ingress.Spec.TLS = []networkingv1.IngressTLS{tls}
+	}
+
+	ingress.Annotations = metadata.ReconcileManagedAnnotations(ingress.Annotations, spec.Annotations)
+
+	if err := controllerutil.SetControllerReference(builder.Instance, ingress, builder.Scheme); err != nil {
+		return fmt.Errorf("failed setting controller reference: %v", err)
+	}
+
+	return nil
+}
+
+func (builder *IngressBuilder) ShouldDeploy(resources []runtime.Object) bool {
+	return builder.Instance.Spec.Ingress != nil && builder.isMapAvailable(resources)
+}
+
+func (builder *IngressBuilder) ShouldPrune(resources []runtime.Object) bool {
+	return builder.Instance.Spec.Ingress == nil
+}
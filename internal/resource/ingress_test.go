@@ -0,0 +1,109 @@
+package resource_test
+
+import (
+	valhallav1alpha1 "github.com/itayankri/valhalla-operator/api/v1alpha1"
+	"github.com/itayankri/valhalla-operator/internal/resource"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Ingress builder", func() {
+	var instance *valhallav1alpha1.Valhalla
+	var builder *resource.IngressBuilder
+	BeforeEach(func() {
+		instance = &valhallav1alpha1.Valhalla{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test",
+				Namespace: "default",
+			},
+			Spec: valhallav1alpha1.ValhallaSpec{
+				Ingress: &valhallav1alpha1.IngressSpec{
+					Host:          "routing.example.com",
+					TLSSecretName: "routing-tls",
+					Annotations:   map[string]string{"cert-manager.io/cluster-issuer": "letsencrypt"},
+				},
+			},
+		}
+		builder = (&resource.ValhallaResourceBuilder{Instance: instance, Scheme: scheme}).Ingress()
+	})
+
+	Context("ShouldDeploy", func() {
+		It("Should return 'false' when the map is not available yet", func() {
+			resources := generateChildResources(true, false)
+			Expect(builder.ShouldDeploy(resources)).To(Equal(false))
+		})
+
+		It("Should return 'true' when the map is available", func() {
+			resources := generateChildResources(true, true)
+			Expect(builder.ShouldDeploy(resources)).To(Equal(true))
+		})
+
+		It("Should return 'false' and prune the Ingress when it is not configured", func() {
+			instance.Spec.Ingress = nil
+			resources := generateChildResources(true, true)
+			Expect(builder.ShouldDeploy(resources)).To(Equal(false))
+			Expect(builder.ShouldPrune(resources)).To(Equal(true))
+		})
+	})
+
+	Context("Update", func() {
+		It("Should route the host to the Service of the workers", func() {
+			object, err := builder.Build()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(builder.Update(object)).To(Succeed())
+
+			ingress := object.(*networkingv1.Ingress)
+			Expect(ingress.Annotations).To(HaveKeyWithValue("cert-manager.io/cluster-issuer", "letsencrypt"))
+			Expect(ingress.Spec.Rules).To(HaveLen(1))
+			Expect(ingress.Spec.Rules[0].Host).To(Equal("routing.example.com"))
+			path := ingress.Spec.Rules[0].HTTP.Paths[0]
+			Expect(path.Path).To(Equal("/"))
+			Expect(*path.PathType).To(Equal(networkingv1.PathTypePrefix))
+			Expect(path.Backend.Service.Name).To(Equal("test"))
+			Expect(path.Backend.Service.Port.Number).To(Equal(int32(80)))
+			Expect(ingress.Spec.TLS).To(Equal([]networkingv1.IngressTLS{
+				{Hosts: []string{"routing.example.com"}, SecretName: "routing-tls"},
+			}))
+			Expect(ingress.OwnerReferences).To(HaveLen(1))
+		})
+
+		It("Should not configure TLS without a TLS Secret", func() {
+			instance.Spec.Ingress.TLSSecretName = ""
+			instance.Spec.Ingress.Path = "/route"
+			object, err := builder.Build()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(builder.Update(object)).To(Succeed())
+
+			ingress := object.(*networkingv1.Ingress)
+			Expect(ingress.Spec.TLS).To(BeEmpty())
+			Expect(ingress.Spec.Rules[0].HTTP.Paths[0].Path).To(Equal("/route"))
+		})
+
+		It("Should remove annotations that were removed from the spec", func() {
+			object, err := builder.Build()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(builder.Update(object)).To(Succeed())
+
+			instance.Spec.Ingress.Annotations = nil
+			Expect(builder.Update(object)).To(Succeed())
+			Expect(object.GetAnnotations()).To(BeEmpty())
+		})
+
+		It("Should keep annotations added by other tools", func() {
+			object, err := builder.Build()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(builder.Update(object)).To(Succeed())
+
+			annotations := object.GetAnnotations()
+			annotations["example.com/added-by"] = "another-controller"
+			object.SetAnnotations(annotations)
+			instance.Spec.Ingress.Annotations = map[string]string{"example.com/owner": "routing"}
+			Expect(builder.Update(object)).To(Succeed())
+			Expect(object.GetAnnotations()).To(HaveKeyWithValue("example.com/added-by", "another-controller"))
+			Expect(object.GetAnnotations()).To(HaveKeyWithValue("example.com/owner", "routing"))
+			Expect(object.GetAnnotations()).NotTo(HaveKey("cert-manager.io/cluster-issuer"))
+		})
+	})
+})
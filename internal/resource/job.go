@@ -2,7 +2,9 @@ package resource
 
 import (
 	"fmt"
+	"strings"
 
+	valhallav1alpha1 "github.com/itayankri/valhalla-operator/api/v1alpha1"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
@@ -20,11 +22,20 @@ func (builder *ValhallaResourceBuilder) Job() *JobBuilder {
 	return &JobBuilder{builder}
 }
 
+// MapBuilderJobName returns the name of the Job building the desired map version.
+func MapBuilderJobName(instance *valhallav1alpha1.Valhalla) string {
+	return instance.ChildResourceName(fmt.Sprintf("%s-%s", JobSuffix, instance.DesiredMapVersion()))
+}
+
 func (builder *JobBuilder) Build() (client.Object, error) {
 	return &batchv1.Job{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      builder.Instance.ChildResourceName(JobSuffix),
+			Name:      MapBuilderJobName(builder.Instance),
 			Namespace: builder.Instance.Namespace,
+			Labels: map[string]string{
+				"app":           builder.Instance.ChildResourceName(JobSuffix),
+				MapVersionLabel: builder.Instance.DesiredMapVersion(),
+			},
 		},
 	}, nil
 }
@@ -32,32 +43,76 @@ func (builder *JobBuilder) Build() (client.Object, error) {
 func (builder *JobBuilder) Update(object client.Object) error {
 	job := object.(*batchv1.Job)
 
-	job.Spec = batchv1.JobSpec{
-		Selector: job.Spec.Selector,
+	// The pod template of a Job is immutable, so the spec is only set when the Job is created.
+	// Changes to spec.builder take effect with the next map build.
+	if job.CreationTimestamp.IsZero() {
+		job.Spec = builder.jobSpec()
+	}
+
+	if err := controllerutil.SetControllerReference(builder.Instance, job, builder.Scheme); err != nil {
+		return fmt.Errorf("failed setting controller reference: %v", err)
+	}
+
+	return nil
+}
+
+func (builder *JobBuilder) jobSpec() batchv1.JobSpec {
+	builderSpec := builder.Instance.Spec.GetBuilder()
+	resources := corev1.ResourceRequirements{
+		Requests: map[corev1.ResourceName]resource.Quantity{
+			"memory": resource.MustParse("1000M"),
+			"cpu":    resource.MustParse("1000m"),
+		},
+	}
+	if builderSpec.Resources != nil {
+		resources = *builderSpec.Resources
+	}
+
+	return batchv1.JobSpec{
+		ActiveDeadlineSeconds:   builderSpec.ActiveDeadlineSeconds,
+		BackoffLimit:            builderSpec.BackoffLimit,
+		TTLSecondsAfterFinished: builderSpec.TTLSecondsAfterFinished,
 		Template: corev1.PodTemplateSpec{
 			ObjectMeta: metav1.ObjectMeta{
-				Labels: job.Spec.Template.ObjectMeta.Labels,
+				Labels: map[string]string{
+					"app": builder.Instance.ChildResourceName(JobSuffix),
+				},
 			},
 			Spec: corev1.PodSpec{
-				RestartPolicy: corev1.RestartPolicyOnFailure,
+				// Failed pods are kept rather than restarted in place, so the operator can still
+				// read their termination messages once the Job has failed.
+				RestartPolicy:    corev1.RestartPolicyNever,
+				NodeSelector:     builderSpec.NodeSelector,
+				Tolerations:      builderSpec.Tolerations,
+				Affinity:         builderSpec.Affinity,
+				ImagePullSecrets: builder.Instance.Spec.ImagePullSecrets,
 				Containers: []corev1.Container{
 					{
-						Name:  "map-builder",
-						Image: mapBuilderImage,
-						Resources: corev1.ResourceRequirements{
-							Requests: map[corev1.ResourceName]resource.Quantity{
-								"memory": resource.MustParse("1000M"),
-								"cpu":    resource.MustParse("1000m"),
-							},
-						},
+						Name:                     "map-builder",
+						Image:                    imageOrDefault(builderSpec.Image, mapBuilderImage),
+						ImagePullPolicy:          builder.Instance.Spec.ImagePullPolicy,
+						TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+						Resources:                resources,
 						Env: []corev1.EnvVar{
 							{
 								Name:  "ROOT_DIR",
 								Value: valhallaDataPath,
 							},
 							{
-								Name:  "PBF_URL",
-								Value: builder.Instance.Spec.PBFURL,
+								Name:  "PBF_URLS",
+								Value: strings.Join(builder.Instance.Spec.GetPBFURLs(), " "),
+							},
+							{
+								Name:  "PBF_CHECKSUMS",
+								Value: builder.pbfChecksums(),
+							},
+							{
+								Name:  "MAP_VERSION",
+								Value: builder.Instance.DesiredMapVersion(),
+							},
+							{
+								Name:  "ACTIVE_MAP_VERSION",
+								Value: builder.Instance.Status.MapVersion,
 							},
 						},
 						VolumeMounts: []corev1.VolumeMount{
@@ -82,14 +137,24 @@ func (builder *JobBuilder) Update(object client.Object) error {
 			},
 		},
 	}
+}
 
-	if err := controllerutil.SetControllerReference(builder.Instance, job, builder.Scheme); err != nil {
-		return fmt.Errorf("failed setting controller reference: %v", err)
+// pbfChecksums lists the checksum of every PBF source in the order of PBF_URLS,
+// with "-" standing for a source that is not verified.
+func (builder *JobBuilder) pbfChecksums() string {
+	checksums := []string{}
+	for _, source := range builder.Instance.Spec.GetPBFSources() {
+		if source.Checksum != nil {
+			checksums = append(checksums, source.Checksum.String())
+		} else {
+			checksums = append(checksums, "-")
+		}
 	}
-
-	return nil
+	return strings.Join(checksums, " ")
 }
 
-func (*JobBuilder) ShouldDeploy(resources []runtime.Object) bool {
-	return true
+// ShouldDeploy returns true as long as the workers do not serve the desired map version.
+func (builder *JobBuilder) ShouldDeploy(resources []runtime.Object) bool {
+	return builder.Instance.Status.MapVersion != builder.Instance.DesiredMapVersion() &&
+		!builder.Instance.IsPaused(valhallav1alpha1.MapBuildsPausedAnnotation)
 }
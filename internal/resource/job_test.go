@@ -1,22 +1,215 @@
 package resource_test
 
 import (
+	"time"
+
+	valhallav1alpha1 "github.com/itayankri/valhalla-operator/api/v1alpha1"
 	"github.com/itayankri/valhalla-operator/internal/resource"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8sresource "k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
 var _ = Describe("Job builder", func() {
+	var instance *valhallav1alpha1.Valhalla
+	var builder resource.ResourceBuilder
+	BeforeEach(func() {
+		instance = &valhallav1alpha1.Valhalla{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test",
+				Namespace: "default",
+			},
+			Spec: valhallav1alpha1.ValhallaSpec{
+				PBFURL: "https://download.geofabrik.de/australia-oceania/marshall-islands-latest.osm.pbf",
+			},
+		}
+		builder = (&resource.ValhallaResourceBuilder{Instance: instance, Scheme: scheme}).Job()
+	})
+
 	Context("ShouldDeploy", func() {
-		var builder resource.ResourceBuilder
-		BeforeEach(func() {
-			builder = valhallaResourceBuilder.Job()
+		It("Should return 'true' when the desired map version has not been built yet", func() {
+			resources := []runtime.Object{}
+			Expect(builder.ShouldDeploy(resources)).To(Equal(true))
 		})
 
-		It("Should always return 'true'", func() {
+		It("Should return 'true' when the workers serve an older map version", func() {
+			instance.Status.MapVersion = "00000000"
 			resources := []runtime.Object{}
 			Expect(builder.ShouldDeploy(resources)).To(Equal(true))
 		})
+
+		It("Should return 'false' when the workers serve the desired map version", func() {
+			instance.Status.MapVersion = instance.DesiredMapVersion()
+			resources := []runtime.Object{}
+			Expect(builder.ShouldDeploy(resources)).To(Equal(false))
+		})
+
+		It("Should return 'false' while map builds are paused", func() {
+			instance.Annotations = map[string]string{valhallav1alpha1.MapBuildsPausedAnnotation: "true"}
+			resources := []runtime.Object{}
+			Expect(builder.ShouldDeploy(resources)).To(Equal(false))
+		})
+	})
+
+	Context("Build", func() {
+		It("Should name the Job after the desired map version", func() {
+			object, err := builder.Build()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(object.GetName()).To(Equal("test-builder-" + instance.DesiredMapVersion()))
+			Expect(object.GetLabels()).To(HaveKeyWithValue(resource.MapVersionLabel, instance.DesiredMapVersion()))
+		})
+
+		It("Should build a differently named Job when the PBF URL changes", func() {
+			object, err := builder.Build()
+			Expect(err).NotTo(HaveOccurred())
+
+			instance.Spec.PBFURL = "https://download.geofabrik.de/europe/monaco-latest.osm.pbf"
+			updatedObject, err := builder.Build()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(updatedObject.GetName()).NotTo(Equal(object.GetName()))
+		})
+
+		It("Should build a differently named Job when a PBF source is added", func() {
+			object, err := builder.Build()
+			Expect(err).NotTo(HaveOccurred())
+
+			instance.Spec.PBFSources = []valhallav1alpha1.PBFSource{
+				{URL: "https://download.geofabrik.de/europe/monaco-latest.osm.pbf"},
+			}
+			updatedObject, err := builder.Build()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(updatedObject.GetName()).NotTo(Equal(object.GetName()))
+		})
+
+		It("Should build a differently named Job when a checksum is added", func() {
+			object, err := builder.Build()
+			Expect(err).NotTo(HaveOccurred())
+
+			instance.Spec.PBFChecksum = &valhallav1alpha1.ChecksumSpec{Value: "abcdef"}
+			updatedObject, err := builder.Build()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(updatedObject.GetName()).NotTo(Equal(object.GetName()))
+		})
+
+		It("Should build a differently named Job when a map refresh is started", func() {
+			object, err := builder.Build()
+			Expect(err).NotTo(HaveOccurred())
+
+			instance.Annotations = map[string]string{valhallav1alpha1.MapRefreshAnnotation: time.Now().UTC().Format(time.RFC3339)}
+			refreshedObject, err := builder.Build()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(refreshedObject.GetName()).NotTo(Equal(object.GetName()))
+		})
+	})
+
+	Context("Update", func() {
+		It("Should build into the desired map version and keep the active one", func() {
+			instance.Status.MapVersion = "00000000"
+			object, err := builder.Build()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(builder.Update(object)).To(Succeed())
+
+			env := object.(*batchv1.Job).Spec.Template.Spec.Containers[0].Env
+			Expect(env).To(ContainElement(HaveField("Value", instance.DesiredMapVersion())))
+			Expect(env).To(ContainElement(HaveField("Value", "00000000")))
+		})
+
+		It("Should verify the checksum of every PBF source that has one", func() {
+			instance.Spec.PBFSources = []valhallav1alpha1.PBFSource{
+				{
+					URL: "https://download.geofabrik.de/europe/monaco-latest.osm.pbf",
+					Checksum: &valhallav1alpha1.ChecksumSpec{
+						URL: "https://download.geofabrik.de/europe/monaco-latest.osm.pbf.md5",
+					},
+				},
+				{
+					URL: "https://download.geofabrik.de/europe/andorra-latest.osm.pbf",
+					Checksum: &valhallav1alpha1.ChecksumSpec{
+						Algorithm: "sha256",
+						Value:     "abcdef",
+					},
+				},
+			}
+			object, err := builder.Build()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(builder.Update(object)).To(Succeed())
+
+			env := object.(*batchv1.Job).Spec.Template.Spec.Containers[0].Env
+			Expect(env).To(ContainElement(corev1.EnvVar{
+				Name:  "PBF_CHECKSUMS",
+				Value: "- md5:https://download.geofabrik.de/europe/monaco-latest.osm.pbf.md5 sha256:abcdef",
+			}))
+		})
+
+		It("Should apply the builder configuration to the Job", func() {
+			backoffLimit := int32(2)
+			instance.Spec.Builder = &valhallav1alpha1.BuilderSpec{
+				Resources: &corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{
+						corev1.ResourceMemory: k8sresource.MustParse("16Gi"),
+					},
+				},
+				NodeSelector: map[string]string{"pool": "high-memory"},
+				Tolerations: []corev1.Toleration{
+					{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "builder", Effect: corev1.TaintEffectNoSchedule},
+				},
+				BackoffLimit: &backoffLimit,
+			}
+			object, err := builder.Build()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(builder.Update(object)).To(Succeed())
+
+			job := object.(*batchv1.Job)
+			Expect(job.Spec.BackoffLimit).To(Equal(&backoffLimit))
+			Expect(job.Spec.Template.Spec.RestartPolicy).To(Equal(corev1.RestartPolicyNever))
+			Expect(job.Spec.Template.Spec.NodeSelector).To(Equal(instance.Spec.Builder.NodeSelector))
+			Expect(job.Spec.Template.Spec.Tolerations).To(Equal(instance.Spec.Builder.Tolerations))
+			Expect(job.Spec.Template.Spec.Containers[0].Resources).To(Equal(*instance.Spec.Builder.Resources))
+		})
+
+		It("Should use the builder image and the instance pull secrets", func() {
+			image := "registry.example.com/valhalla-builder:3.4.0"
+			instance.Spec.Builder = &valhallav1alpha1.BuilderSpec{Image: &image}
+			instance.Spec.ImagePullSecrets = []corev1.LocalObjectReference{{Name: "registry-credentials"}}
+			object, err := builder.Build()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(builder.Update(object)).To(Succeed())
+
+			podSpec := object.(*batchv1.Job).Spec.Template.Spec
+			Expect(podSpec.Containers[0].Image).To(Equal(image))
+			Expect(podSpec.ImagePullSecrets).To(Equal(instance.Spec.ImagePullSecrets))
+		})
+
+		It("Should not change the spec of an existing Job", func() {
+			object, err := builder.Build()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(builder.Update(object)).To(Succeed())
+			object.SetCreationTimestamp(metav1.Now())
+
+			instance.Spec.Builder = &valhallav1alpha1.BuilderSpec{
+				NodeSelector: map[string]string{"pool": "high-memory"},
+			}
+			Expect(builder.Update(object)).To(Succeed())
+			Expect(object.(*batchv1.Job).Spec.Template.Spec.NodeSelector).To(BeEmpty())
+		})
+
+		It("Should download every PBF source", func() {
+			instance.Spec.PBFSources = []valhallav1alpha1.PBFSource{
+				{URL: "https://download.geofabrik.de/europe/monaco-latest.osm.pbf"},
+			}
+			object, err := builder.Build()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(builder.Update(object)).To(Succeed())
+
+			env := object.(*batchv1.Job).Spec.Template.Spec.Containers[0].Env
+			Expect(env).To(ContainElement(corev1.EnvVar{
+				Name:  "PBF_URLS",
+				Value: instance.Spec.PBFURL + " https://download.geofabrik.de/europe/monaco-latest.osm.pbf",
+			}))
+		})
 	})
 })
@@ -0,0 +1,144 @@
+package resource
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// NetworkPolicyBuilder builds the NetworkPolicy of one kind of pod run by the operator:
+// the workers, the map builder or the predicted traffic fetcher.
+type NetworkPolicyBuilder struct {
+	*ValhallaResourceBuilder
+	suffix     string
+	podSuffix  string
+	policySpec func() networkingv1.NetworkPolicySpec
+	enabled    func() bool
+}
+
+func (builder *ValhallaResourceBuilder) WorkersNetworkPolicy() *NetworkPolicyBuilder {
+	networkPolicyBuilder := &NetworkPolicyBuilder{
+		ValhallaResourceBuilder: builder,
+		suffix:                  WorkersNetworkPolicySuffix,
+		podSuffix:               DeploymentSuffix,
+		enabled:                 func() bool { return builder.Instance.Spec.NetworkPolicy != nil },
+	}
+	networkPolicyBuilder.policySpec = networkPolicyBuilder.workersPolicySpec
+	return networkPolicyBuilder
+}
+
+func (builder *ValhallaResourceBuilder) BuilderNetworkPolicy() *NetworkPolicyBuilder {
+	networkPolicyBuilder := &NetworkPolicyBuilder{
+		ValhallaResourceBuilder: builder,
+		suffix:                  BuilderNetworkPolicySuffix,
+		podSuffix:               JobSuffix,
+		enabled:                 func() bool { return builder.Instance.Spec.NetworkPolicy != nil },
+	}
+	networkPolicyBuilder.policySpec = networkPolicyBuilder.downloadPolicySpec
+	return networkPolicyBuilder
+}
+
+func (builder *ValhallaResourceBuilder) PredictedTrafficNetworkPolicy() *NetworkPolicyBuilder {
+	networkPolicyBuilder := &NetworkPolicyBuilder{
+		ValhallaResourceBuilder: builder,
+		suffix:                  PredictedTrafficNetworkPolicySuffix,
+		podSuffix:               CronJobSuffix,
+		enabled: func() bool {
+			return builder.Instance.Spec.NetworkPolicy != nil && builder.Instance.Spec.PredictedTraffic != nil
+		},
+	}
+	networkPolicyBuilder.policySpec = networkPolicyBuilder.downloadPolicySpec
+	return networkPolicyBuilder
+}
+
+func (builder *NetworkPolicyBuilder) Build() (client.Object, error) {
+	return &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      builder.Instance.ChildResourceName(builder.suffix),
+			Namespace: builder.Instance.Namespace,
+		},
+	}, nil
+}
+
+func (builder *NetworkPolicyBuilder) Update(object client.Object) error {
+	networkPolicy := object.(*networkingv1.NetworkPolicy)
+
+	networkPolicy.Spec = builder.policySpec()
+
+	if err := controllerutil.SetControllerReference(builder.Instance, networkPolicy, builder.Scheme); err != nil {
+		return fmt.Errorf("failed setting controller reference: %v", err)
+	}
+
+	return nil
+}
+
+// ShouldDeploy does not wait for other resources, so that the policies are in place
+// before the pods they select are started.
+func (builder *NetworkPolicyBuilder) ShouldDeploy(resources []runtime.Object) bool {
+	return builder.enabled()
+}
+
+func (builder *NetworkPolicyBuilder) ShouldPrune(resources []runtime.Object) bool {
+	return !builder.enabled()
+}
+
+func (builder *NetworkPolicyBuilder) podSelector() metav1.LabelSelector {
+	return metav1.LabelSelector{
+		MatchLabels: map[string]string{
+			"app": builder.Instance.ChildResourceName(builder.podSuffix),
+		},
+	}
+}
+
+// workersPolicySpec allows traffic to the Valhalla port of the workers from the allowed peers only.
+func (builder *NetworkPolicyBuilder) workersPolicySpec() networkingv1.NetworkPolicySpec {
+	return networkingv1.NetworkPolicySpec{
+		PodSelector: builder.podSelector(),
+		PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+		Ingress: []networkingv1.NetworkPolicyIngressRule{
+			{
+				Ports: []networkingv1.NetworkPolicyPort{
+					networkPolicyPort(corev1.ProtocolTCP, containerPort),
+				},
+				From: builder.Instance.Spec.NetworkPolicy.AllowedFrom,
+			},
+		},
+	}
+}
+
+// downloadPolicySpec denies all incoming traffic and allows DNS lookups and downloads over HTTP and HTTPS.
+func (builder *NetworkPolicyBuilder) downloadPolicySpec() networkingv1.NetworkPolicySpec {
+	return networkingv1.NetworkPolicySpec{
+		PodSelector: builder.podSelector(),
+		PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress},
+		Egress: []networkingv1.NetworkPolicyEgressRule{
+			{
+				Ports: []networkingv1.NetworkPolicyPort{
+					networkPolicyPort(corev1.ProtocolUDP, 53),
+					networkPolicyPort(corev1.ProtocolTCP, 53),
+				},
+			},
+			{
+				Ports: []networkingv1.NetworkPolicyPort{
+					networkPolicyPort(corev1.ProtocolTCP, 80),
+					networkPolicyPort(corev1.ProtocolTCP, 443),
+				},
+				To: builder.Instance.Spec.NetworkPolicy.DownloadTo,
+			},
+		},
+	}
+}
+
+func networkPolicyPort(protocol corev1.Protocol, port int) networkingv1.NetworkPolicyPort {
+	portNumber := intstr.FromInt(port)
+	return networkingv1.NetworkPolicyPort{
+		Protocol: &protocol,
+		Port:     &portNumber,
+	}
+}
@@ -0,0 +1,128 @@
+package resource_test
+
+import (
+	valhallav1alpha1 "github.com/itayankri/valhalla-operator/api/v1alpha1"
+	"github.com/itayankri/valhalla-operator/internal/resource"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+var _ = Describe("NetworkPolicy builder", func() {
+	var instance *valhallav1alpha1.Valhalla
+	var valhallaBuilder *resource.ValhallaResourceBuilder
+	allowedFrom := []networkingv1.NetworkPolicyPeer{
+		{
+			NamespaceSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"kubernetes.io/metadata.name": "ingress-nginx"},
+			},
+		},
+	}
+	BeforeEach(func() {
+		instance = &valhallav1alpha1.Valhalla{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test",
+				Namespace: "default",
+			},
+			Spec: valhallav1alpha1.ValhallaSpec{
+				NetworkPolicy: &valhallav1alpha1.NetworkPolicySpec{
+					AllowedFrom: allowedFrom,
+				},
+			},
+		}
+		valhallaBuilder = &resource.ValhallaResourceBuilder{Instance: instance, Scheme: scheme}
+	})
+
+	update := func(builder resource.ResourceBuilder) *networkingv1.NetworkPolicy {
+		object, err := builder.Build()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(builder.Update(object)).To(Succeed())
+		return object.(*networkingv1.NetworkPolicy)
+	}
+
+	Context("ShouldDeploy", func() {
+		It("Should deploy the policies before the map is built", func() {
+			resources := []runtime.Object{}
+			Expect(valhallaBuilder.WorkersNetworkPolicy().ShouldDeploy(resources)).To(Equal(true))
+			Expect(valhallaBuilder.BuilderNetworkPolicy().ShouldDeploy(resources)).To(Equal(true))
+		})
+
+		It("Should only deploy the predicted traffic policy when predicted traffic is configured", func() {
+			resources := []runtime.Object{}
+			Expect(valhallaBuilder.PredictedTrafficNetworkPolicy().ShouldDeploy(resources)).To(Equal(false))
+			Expect(valhallaBuilder.PredictedTrafficNetworkPolicy().ShouldPrune(resources)).To(Equal(true))
+
+			instance.Spec.PredictedTraffic = &valhallav1alpha1.PredictedTrafficSpec{}
+			Expect(valhallaBuilder.PredictedTrafficNetworkPolicy().ShouldDeploy(resources)).To(Equal(true))
+		})
+
+		It("Should prune the policies when network policies are disabled", func() {
+			instance.Spec.NetworkPolicy = nil
+			resources := []runtime.Object{}
+			for _, builder := range []*resource.NetworkPolicyBuilder{
+				valhallaBuilder.WorkersNetworkPolicy(),
+				valhallaBuilder.BuilderNetworkPolicy(),
+				valhallaBuilder.PredictedTrafficNetworkPolicy(),
+			} {
+				Expect(builder.ShouldDeploy(resources)).To(Equal(false))
+				Expect(builder.ShouldPrune(resources)).To(Equal(true))
+			}
+		})
+	})
+
+	Context("Update", func() {
+		It("Should only allow traffic to the Valhalla port of the workers from the allowed peers", func() {
+			networkPolicy := update(valhallaBuilder.WorkersNetworkPolicy())
+			Expect(networkPolicy.Name).To(Equal("test-workers"))
+			Expect(networkPolicy.Spec.PodSelector.MatchLabels).To(Equal(map[string]string{"app": "test"}))
+			Expect(networkPolicy.Spec.PolicyTypes).To(Equal([]networkingv1.PolicyType{networkingv1.PolicyTypeIngress}))
+			Expect(networkPolicy.Spec.Ingress).To(HaveLen(1))
+			Expect(networkPolicy.Spec.Ingress[0].From).To(Equal(allowedFrom))
+			Expect(networkPolicy.Spec.Ingress[0].Ports).To(HaveLen(1))
+			Expect(*networkPolicy.Spec.Ingress[0].Ports[0].Port).To(Equal(intstr.FromInt(8002)))
+		})
+
+		It("Should limit the map builder pods to DNS and downloads", func() {
+			networkPolicy := update(valhallaBuilder.BuilderNetworkPolicy())
+			Expect(networkPolicy.Name).To(Equal("test-builder"))
+			Expect(networkPolicy.Spec.PodSelector.MatchLabels).To(Equal(map[string]string{"app": "test-builder"}))
+			Expect(networkPolicy.Spec.PolicyTypes).To(ConsistOf(networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress))
+			Expect(networkPolicy.Spec.Ingress).To(BeEmpty())
+			Expect(networkPolicy.Spec.Egress).To(HaveLen(2))
+
+			ports := []int{}
+			for _, rule := range networkPolicy.Spec.Egress {
+				for _, port := range rule.Ports {
+					ports = append(ports, port.Port.IntValue())
+				}
+			}
+			Expect(ports).To(ConsistOf(53, 53, 80, 443))
+		})
+
+		It("Should select the predicted traffic pods", func() {
+			instance.Spec.PredictedTraffic = &valhallav1alpha1.PredictedTrafficSpec{}
+			networkPolicy := update(valhallaBuilder.PredictedTrafficNetworkPolicy())
+			Expect(networkPolicy.Name).To(Equal("test-predicted-traffic"))
+			Expect(networkPolicy.Spec.PodSelector.MatchLabels).To(Equal(map[string]string{"app": "test-predicted-traffic"}))
+		})
+
+		It("Should label the pods selected by the policies", func() {
+			jobBuilder := valhallaBuilder.Job()
+			object, err := jobBuilder.Build()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(jobBuilder.Update(object)).To(Succeed())
+			Expect(object.(*batchv1.Job).Spec.Template.Labels).To(HaveKeyWithValue("app", "test-builder"))
+
+			instance.Spec.PredictedTraffic = &valhallav1alpha1.PredictedTrafficSpec{}
+			cronJobBuilder := valhallaBuilder.CronJob()
+			object, err = cronJobBuilder.Build()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cronJobBuilder.Update(object)).To(Succeed())
+			Expect(object.(*batchv1.CronJob).Spec.JobTemplate.Spec.Template.Labels).To(HaveKeyWithValue("app", "test-predicted-traffic"))
+		})
+	})
+})
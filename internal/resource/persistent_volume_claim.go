@@ -32,7 +32,7 @@ func (builder *PersistentVolumeClaimBuilder) Build() (client.Object, error) {
 			},
 			Resources: corev1.ResourceRequirements{
 				Requests: map[corev1.ResourceName]resource.Quantity{
-					corev1.ResourceStorage: *builder.Instance.Spec.Persistence.Storage,
+					corev1.ResourceStorage: builder.Instance.Spec.Persistence.GetStorage(),
 				},
 			},
 			VolumeName:       "",
@@ -44,6 +44,21 @@ func (builder *PersistentVolumeClaimBuilder) Build() (client.Object, error) {
 func (builder *PersistentVolumeClaimBuilder) Update(object client.Object) error {
 	pvc := object.(*corev1.PersistentVolumeClaim)
 
+	// A claim retained by a deleted instance of the same name is adopted.
+	delete(pvc.Labels, RetainedLabel)
+
+	// The spec of an existing claim is immutable apart from its requested storage,
+	// which can only grow and only when its StorageClass allows volume expansion.
+	if !pvc.CreationTimestamp.IsZero() && builder.VolumeExpansionAllowed {
+		storage := builder.Instance.Spec.Persistence.GetStorage()
+		if requested := pvc.Spec.Resources.Requests[corev1.ResourceStorage]; storage.Cmp(requested) > 0 {
+			if pvc.Spec.Resources.Requests == nil {
+				pvc.Spec.Resources.Requests = corev1.ResourceList{}
+			}
+			pvc.Spec.Resources.Requests[corev1.ResourceStorage] = storage
+		}
+	}
+
 	if err := controllerutil.SetControllerReference(builder.Instance, pvc, builder.Scheme); err != nil {
 		return fmt.Errorf("failed setting controller reference: %v", err)
 	}
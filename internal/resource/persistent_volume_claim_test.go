@@ -1,9 +1,13 @@
 package resource_test
 
 import (
+	valhallav1alpha1 "github.com/itayankri/valhalla-operator/api/v1alpha1"
 	"github.com/itayankri/valhalla-operator/internal/resource"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	k8sresource "k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -19,4 +23,61 @@ var _ = Describe("PersistentVolumeClaim builder", func() {
 			Expect(builder.ShouldDeploy(resources)).To(Equal(true))
 		})
 	})
+
+	Context("Update", func() {
+		var instance *valhallav1alpha1.Valhalla
+		var resourceBuilder *resource.ValhallaResourceBuilder
+		BeforeEach(func() {
+			storage := k8sresource.MustParse("20Gi")
+			instance = &valhallav1alpha1.Valhalla{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test",
+					Namespace: "default",
+				},
+				Spec: valhallav1alpha1.ValhallaSpec{
+					Persistence: valhallav1alpha1.PersistenceSpec{Storage: &storage},
+				},
+			}
+			resourceBuilder = &resource.ValhallaResourceBuilder{Instance: instance, Scheme: scheme, VolumeExpansionAllowed: true}
+		})
+
+		existingClaim := func(storage string) *corev1.PersistentVolumeClaim {
+			object, err := resourceBuilder.PersistentVolumeClaim().Build()
+			Expect(err).NotTo(HaveOccurred())
+			pvc := object.(*corev1.PersistentVolumeClaim)
+			pvc.CreationTimestamp = metav1.Now()
+			pvc.Spec.Resources.Requests[corev1.ResourceStorage] = k8sresource.MustParse(storage)
+			return pvc
+		}
+
+		It("Should expand an existing claim when the storage grows", func() {
+			pvc := existingClaim("10Gi")
+			Expect(resourceBuilder.PersistentVolumeClaim().Update(pvc)).To(Succeed())
+			Expect(pvc.Spec.Resources.Requests[corev1.ResourceStorage]).To(Equal(k8sresource.MustParse("20Gi")))
+		})
+
+		It("Should not expand a claim whose StorageClass does not allow volume expansion", func() {
+			resourceBuilder.VolumeExpansionAllowed = false
+			pvc := existingClaim("10Gi")
+			Expect(resourceBuilder.PersistentVolumeClaim().Update(pvc)).To(Succeed())
+			Expect(pvc.Spec.Resources.Requests[corev1.ResourceStorage]).To(Equal(k8sresource.MustParse("10Gi")))
+		})
+
+		It("Should never shrink a claim", func() {
+			pvc := existingClaim("50Gi")
+			Expect(resourceBuilder.PersistentVolumeClaim().Update(pvc)).To(Succeed())
+			Expect(pvc.Spec.Resources.Requests[corev1.ResourceStorage]).To(Equal(k8sresource.MustParse("50Gi")))
+		})
+
+		It("Should adopt a PersistentVolumeClaim retained by a deleted instance", func() {
+			builder := resourceBuilder.PersistentVolumeClaim()
+			object, err := builder.Build()
+			Expect(err).NotTo(HaveOccurred())
+			object.SetLabels(map[string]string{resource.RetainedLabel: "test"})
+
+			Expect(builder.Update(object)).To(Succeed())
+			Expect(object.GetLabels()).NotTo(HaveKey(resource.RetainedLabel))
+			Expect(metav1.IsControlledBy(object, instance)).To(BeTrue())
+		})
+	})
 })
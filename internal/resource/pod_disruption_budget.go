@@ -3,7 +3,6 @@ package resource
 import (
 	"fmt"
 
-	"github.com/itayankri/valhalla-operator/internal/status"
 	policyv1 "k8s.io/api/policy/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -46,6 +45,6 @@ func (builder *PodDisruptionBudgetBuilder) Update(object client.Object) error {
 	return nil
 }
 
-func (*PodDisruptionBudgetBuilder) ShouldDeploy(resources []runtime.Object) bool {
-	return status.IsPersistentVolumeClaimBound(resources) && status.IsJobCompleted(resources)
+func (builder *PodDisruptionBudgetBuilder) ShouldDeploy(resources []runtime.Object) bool {
+	return builder.isMapAvailable(resources)
 }
@@ -1,7 +1,11 @@
 package resource
 
 import (
+	"path"
+
 	valhallav1alpha1 "github.com/itayankri/valhalla-operator/api/v1alpha1"
+	"github.com/itayankri/valhalla-operator/internal/status"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -12,20 +16,69 @@ type ResourceBuilder interface {
 	ShouldDeploy(resources []runtime.Object) bool
 }
 
+// ResourcePruner is implemented by builders of optional resources. A builder returning
+// 'false' from ShouldDeploy may only be waiting for other resources, so existing objects
+// are deleted only when ShouldPrune reports that the resource is no longer desired.
+type ResourcePruner interface {
+	ShouldPrune(resources []runtime.Object) bool
+}
+
 type ValhallaResourceBuilder struct {
 	Instance *valhallav1alpha1.Valhalla
 	Scheme   *runtime.Scheme
+
+	// Secrets are the Secrets referenced by the worker pods, whose content is hashed
+	// into the pod template so that the workers are rolled out when it changes.
+	Secrets []corev1.Secret
+
+	// ScalingWindow is the window of spec.scalingSchedule that is currently active, if any.
+	ScalingWindow *valhallav1alpha1.ScalingWindowSpec
+
+	// VolumeExpansionAllowed reports whether the StorageClass of the PersistentVolumeClaim allows volume expansion.
+	VolumeExpansionAllowed bool
 }
 
 func (builder *ValhallaResourceBuilder) ResourceBuilders() []ResourceBuilder {
 	builders := []ResourceBuilder{
 		builder.PersistentVolumeClaim(),
+		builder.WorkersNetworkPolicy(),
+		builder.BuilderNetworkPolicy(),
+		builder.PredictedTrafficNetworkPolicy(),
 		builder.Job(),
 		builder.CronJob(),
+		builder.ConfigMap(),
 		builder.Deployment(),
 		builder.Service(),
+		builder.Ingress(),
+		builder.HTTPRoute(),
 		builder.HorizontalPodAutoscaler(),
 		builder.PodDisruptionBudget(),
 	}
 	return builders
 }
+
+// isMapAvailable reports whether there are map tiles the workers can be served from,
+// either a previously built version or the one built by a completed builder Job.
+func (builder *ValhallaResourceBuilder) isMapAvailable(resources []runtime.Object) bool {
+	return status.IsPersistentVolumeClaimBound(resources) &&
+		(builder.Instance.Status.MapVersion != "" || status.IsJobCompleted(resources))
+}
+
+// servedMapVersion returns the version of the map tiles the workers should serve.
+func (builder *ValhallaResourceBuilder) servedMapVersion() string {
+	if builder.Instance.Status.MapVersion != "" {
+		return builder.Instance.Status.MapVersion
+	}
+	return builder.Instance.DesiredMapVersion()
+}
+
+func imageOrDefault(image *string, defaultImage string) string {
+	if image != nil && *image != "" {
+		return *image
+	}
+	return defaultImage
+}
+
+func mapPath(version string) string {
+	return path.Join(valhallaMapsPath, version)
+}
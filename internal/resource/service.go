@@ -4,7 +4,6 @@ import (
 	"fmt"
 
 	"github.com/itayankri/valhalla-operator/internal/metadata"
-	"github.com/itayankri/valhalla-operator/internal/status"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -34,13 +33,17 @@ func (builder *ServiceBuilder) Update(object client.Object) error {
 	name := builder.Instance.ChildResourceName(ServiceSuffix)
 
 	service := object.(*corev1.Service)
+	nodePorts := map[string]int32{}
+	for _, port := range service.Spec.Ports {
+		nodePorts[port.Name] = port.NodePort
+	}
 
 	service.Spec.Type = corev1.ServiceTypeClusterIP
 	service.Spec.Ports = []corev1.ServicePort{
 		{
 			Name:     "default",
 			Protocol: corev1.ProtocolTCP,
-			Port:     80,
+			Port:     servicePort,
 			TargetPort: intstr.IntOrString{
 				Type:   intstr.Int,
 				IntVal: containerPort,
@@ -59,6 +62,11 @@ func (builder *ServiceBuilder) Update(object client.Object) error {
 		builder.setAnnotations(service)
 	}
 
+	// The node port allocated by the API server is kept, so that an unchanged Service is not updated.
+	if service.Spec.Type == corev1.ServiceTypeNodePort || service.Spec.Type == corev1.ServiceTypeLoadBalancer {
+		service.Spec.Ports[0].NodePort = nodePorts[service.Spec.Ports[0].Name]
+	}
+
 	if err := controllerutil.SetControllerReference(builder.Instance, service, builder.Scheme); err != nil {
 		return fmt.Errorf("failed setting controller reference: %v", err)
 	}
@@ -66,8 +74,8 @@ func (builder *ServiceBuilder) Update(object client.Object) error {
 	return nil
 }
 
-func (*ServiceBuilder) ShouldDeploy(resources []runtime.Object) bool {
-	return status.IsPersistentVolumeClaimBound(resources) && status.IsJobCompleted(resources)
+func (builder *ServiceBuilder) ShouldDeploy(resources []runtime.Object) bool {
+	return builder.isMapAvailable(resources)
 }
 
 func (builder *ServiceBuilder) setAnnotations(service *corev1.Service) {
@@ -1,9 +1,12 @@
 package resource_test
 
 import (
+	valhallav1alpha1 "github.com/itayankri/valhalla-operator/api/v1alpha1"
 	"github.com/itayankri/valhalla-operator/internal/resource"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 var _ = Describe("Service builder", func() {
@@ -33,4 +36,42 @@ var _ = Describe("Service builder", func() {
 			Expect(builder.ShouldDeploy(resources)).To(Equal(true))
 		})
 	})
+	Context("Update", func() {
+		var instance *valhallav1alpha1.Valhalla
+		var builder resource.ResourceBuilder
+		BeforeEach(func() {
+			instance = &valhallav1alpha1.Valhalla{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test",
+					Namespace: "default",
+				},
+			}
+			builder = (&resource.ValhallaResourceBuilder{Instance: instance, Scheme: scheme}).Service()
+		})
+
+		It("Should keep the node port allocated by the API server", func() {
+			instance.Spec.Service = &valhallav1alpha1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer}
+			object, err := builder.Build()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(builder.Update(object)).To(Succeed())
+
+			service := object.(*corev1.Service)
+			service.Spec.Ports[0].NodePort = 30080
+			Expect(builder.Update(service)).To(Succeed())
+			Expect(service.Spec.Ports[0].NodePort).To(Equal(int32(30080)))
+		})
+
+		It("Should release the node port when the Service is changed to ClusterIP", func() {
+			instance.Spec.Service = &valhallav1alpha1.ServiceSpec{Type: corev1.ServiceTypeNodePort}
+			object, err := builder.Build()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(builder.Update(object)).To(Succeed())
+
+			service := object.(*corev1.Service)
+			service.Spec.Ports[0].NodePort = 30080
+			instance.Spec.Service.Type = corev1.ServiceTypeClusterIP
+			Expect(builder.Update(service)).To(Succeed())
+			Expect(service.Spec.Ports[0].NodePort).To(BeZero())
+		})
+	})
 })
@@ -13,6 +13,7 @@ import (
 )
 
 var valhallaResourceBuilder *resource.ValhallaResourceBuilder
+var scheme *runtime.Scheme
 
 func TestStatus(t *testing.T) {
 	RegisterFailHandler(Fail)
@@ -20,6 +21,9 @@ func TestStatus(t *testing.T) {
 }
 
 var _ = BeforeSuite(func() {
+	scheme = runtime.NewScheme()
+	Expect(valhallav1alpha1.AddToScheme(scheme)).To(Succeed())
+
 	valhallaResourceBuilder = &resource.ValhallaResourceBuilder{
 		Instance: &valhallav1alpha1.Valhalla{},
 	}
@@ -0,0 +1,60 @@
+package resource
+
+import (
+	"fmt"
+
+	valhallav1alpha1 "github.com/itayankri/valhalla-operator/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// VolumeSnapshotGroupVersionKind is the CSI VolumeSnapshot. It is managed as an unstructured
+// object, so that the operator does not depend on the snapshot CRDs being installed.
+var VolumeSnapshotGroupVersionKind = schema.GroupVersionKind{
+	Group:   "snapshot.storage.k8s.io",
+	Version: "v1",
+	Kind:    "VolumeSnapshot",
+}
+
+// VolumeSnapshot builds the snapshot taken of the PersistentVolumeClaim of an instance that is being deleted.
+// It is not owned by the instance, so that it outlives it, and it is named after the deletion time,
+// so that the snapshots of successive instances of the same name do not collide.
+func VolumeSnapshot(instance *valhallav1alpha1.Valhalla) *unstructured.Unstructured {
+	claimName := instance.ChildResourceName(PersistentVolumeClaimSuffix)
+	snapshot := &unstructured.Unstructured{}
+	snapshot.SetGroupVersionKind(VolumeSnapshotGroupVersionKind)
+	snapshot.SetNamespace(instance.Namespace)
+	if instance.DeletionTimestamp != nil {
+		snapshot.SetName(fmt.Sprintf("%s-%d", claimName, instance.DeletionTimestamp.Unix()))
+	} else {
+		snapshot.SetName(claimName)
+	}
+	snapshot.SetLabels(map[string]string{
+		"app":         claimName,
+		RetainedLabel: instance.Name,
+	})
+	snapshot.SetAnnotations(map[string]string{
+		MapVersionAnnotation: instance.Status.MapVersion,
+	})
+
+	spec := map[string]interface{}{
+		"source": map[string]interface{}{
+			"persistentVolumeClaimName": claimName,
+		},
+	}
+	if snapshotSpec := instance.Spec.Persistence.SnapshotBeforeDeletion; snapshotSpec != nil && snapshotSpec.VolumeSnapshotClassName != "" {
+		spec["volumeSnapshotClassName"] = snapshotSpec.VolumeSnapshotClassName
+	}
+	snapshot.Object["spec"] = spec
+	return snapshot
+}
+
+// IsVolumeSnapshotReady reports whether the snapshot controller has taken the snapshot, i.e. it is bound to
+// a VolumeSnapshotContent or ready to use. Until then the source claim must not be deleted.
+func IsVolumeSnapshotReady(snapshot *unstructured.Unstructured) bool {
+	if readyToUse, _, _ := unstructured.NestedBool(snapshot.Object, "status", "readyToUse"); readyToUse {
+		return true
+	}
+	contentName, _, _ := unstructured.NestedString(snapshot.Object, "status", "boundVolumeSnapshotContentName")
+	return contentName != ""
+}
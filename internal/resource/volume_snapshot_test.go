@@ -0,0 +1,71 @@
+package resource_test
+
+import (
+	"time"
+
+	valhallav1alpha1 "github.com/itayankri/valhalla-operator/api/v1alpha1"
+	"github.com/itayankri/valhalla-operator/internal/resource"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+var _ = Describe("VolumeSnapshot", func() {
+	var instance *valhallav1alpha1.Valhalla
+	deletionTimestamp := metav1.NewTime(time.Unix(1677672000, 0))
+	BeforeEach(func() {
+		instance = &valhallav1alpha1.Valhalla{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              "test",
+				Namespace:         "default",
+				DeletionTimestamp: &deletionTimestamp,
+			},
+			Spec: valhallav1alpha1.ValhallaSpec{
+				Persistence: valhallav1alpha1.PersistenceSpec{
+					SnapshotBeforeDeletion: &valhallav1alpha1.VolumeSnapshotSpec{},
+				},
+			},
+			Status: valhallav1alpha1.ValhallaStatus{
+				MapVersion: "1a2b3c4d",
+			},
+		}
+	})
+
+	It("Should snapshot the PersistentVolumeClaim of the instance", func() {
+		snapshot := resource.VolumeSnapshot(instance)
+		Expect(snapshot.GroupVersionKind()).To(Equal(resource.VolumeSnapshotGroupVersionKind))
+		Expect(snapshot.GetName()).To(Equal("test-1677672000"))
+		Expect(snapshot.GetOwnerReferences()).To(BeEmpty())
+		Expect(snapshot.GetLabels()).To(HaveKeyWithValue(resource.RetainedLabel, "test"))
+		Expect(snapshot.GetAnnotations()).To(HaveKeyWithValue(resource.MapVersionAnnotation, "1a2b3c4d"))
+
+		claimName, _, err := unstructured.NestedString(snapshot.Object, "spec", "source", "persistentVolumeClaimName")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(claimName).To(Equal("test"))
+		_, found, _ := unstructured.NestedString(snapshot.Object, "spec", "volumeSnapshotClassName")
+		Expect(found).To(BeFalse())
+	})
+
+	It("Should use the VolumeSnapshotClass from the instance spec", func() {
+		instance.Spec.Persistence.SnapshotBeforeDeletion.VolumeSnapshotClassName = "csi-snapclass"
+		className, _, err := unstructured.NestedString(resource.VolumeSnapshot(instance).Object, "spec", "volumeSnapshotClassName")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(className).To(Equal("csi-snapclass"))
+	})
+
+	It("Should report a snapshot as ready once it is bound to a VolumeSnapshotContent or ready to use", func() {
+		snapshot := resource.VolumeSnapshot(instance)
+		Expect(resource.IsVolumeSnapshotReady(snapshot)).To(BeFalse())
+
+		Expect(unstructured.SetNestedField(snapshot.Object, false, "status", "readyToUse")).To(Succeed())
+		Expect(resource.IsVolumeSnapshotReady(snapshot)).To(BeFalse())
+
+		Expect(unstructured.SetNestedField(snapshot.Object, "snapcontent-1", "status", "boundVolumeSnapshotContentName")).To(Succeed())
+		Expect(resource.IsVolumeSnapshotReady(snapshot)).To(BeTrue())
+
+		snapshot = resource.VolumeSnapshot(instance)
+		Expect(unstructured.SetNestedField(snapshot.Object, true, "status", "readyToUse")).To(Succeed())
+		Expect(resource.IsVolumeSnapshotReady(snapshot)).To(BeTrue())
+	})
+})
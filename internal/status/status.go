@@ -1,11 +1,16 @@
 package status
 
 import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 )
@@ -14,8 +19,13 @@ const (
 	ConditionAvailable             = "Available"
 	ConditionReconciliationSuccess = "ReconciliationSuccess"
 	ConditionAllReplicasReady      = "AllReplicasReady"
+	ConditionMapBuilt              = "MapBuilt"
+	ConditionVolumeResized         = "VolumeResized"
 )
 
+// maxTerminationMessageLines bounds the termination messages reported in the MapBuilt condition.
+const maxTerminationMessageLines = 10
+
 func AvailableCondition(resources []runtime.Object, old *metav1.Condition) metav1.Condition {
 	condition := metav1.Condition{
 		Type:    ConditionAvailable,
@@ -79,6 +89,100 @@ func AllReplicasReadyCondition(resources []runtime.Object, old *metav1.Condition
 	return condition
 }
 
+// MapBuiltCondition reports whether the desired map version is built. When the builder Job failed,
+// the message holds the reason of the failure followed by failureMessage, the termination messages of the map builder.
+// The message of the old condition is kept when failureMessage is empty, e.g. because the failed pods were removed.
+func MapBuiltCondition(resources []runtime.Object, mapBuilt bool, failureMessage string, old *metav1.Condition) metav1.Condition {
+	condition := metav1.Condition{
+		Type:    ConditionMapBuilt,
+		Status:  metav1.ConditionFalse,
+		Reason:  "MapBuildPending",
+		Message: "The map build has not started yet",
+	}
+
+	if old != nil {
+		condition.LastTransitionTime = old.LastTransitionTime
+	}
+
+	jobFailedCondition := JobFailedCondition(resources)
+	switch {
+	case mapBuilt:
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "MapBuilt"
+		condition.Message = "The desired map version is built"
+	case jobFailedCondition != nil:
+		condition.Reason = "MapBuildFailed"
+		condition.Message = fmt.Sprintf("%s: %s", jobFailedCondition.Reason, jobFailedCondition.Message)
+		if failureMessage != "" {
+			condition.Message = fmt.Sprintf("%s\n%s", condition.Message, failureMessage)
+		} else if old != nil && old.Reason == condition.Reason {
+			condition.Message = old.Message
+		}
+	case hasJob(resources):
+		condition.Reason = "MapBuilding"
+		condition.Message = "The map builder Job is running"
+	}
+
+	if old == nil || old.Status != condition.Status {
+		condition.LastTransitionTime = metav1.Time{
+			Time: time.Now(),
+		}
+	}
+
+	return condition
+}
+
+// VolumeResizedCondition reports whether the PersistentVolumeClaim has the requested storage, and otherwise
+// the progress of its expansion, including the FileSystemResizePending and Resizing conditions of the claim.
+func VolumeResizedCondition(resources []runtime.Object, storage resource.Quantity, expansionAllowed bool) metav1.Condition {
+	condition := metav1.Condition{
+		Type:    ConditionVolumeResized,
+		Status:  metav1.ConditionTrue,
+		Reason:  "Resized",
+		Message: "The volume has the requested storage",
+	}
+
+	var pvc *corev1.PersistentVolumeClaim
+	for _, object := range resources {
+		if claim, ok := object.(*corev1.PersistentVolumeClaim); ok {
+			pvc = claim
+			break
+		}
+	}
+	if pvc == nil {
+		return condition
+	}
+
+	requested := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+	capacity := pvc.Status.Capacity[corev1.ResourceStorage]
+	for _, claimCondition := range pvc.Status.Conditions {
+		if claimCondition.Status != corev1.ConditionTrue {
+			continue
+		}
+		if claimCondition.Type == corev1.PersistentVolumeClaimFileSystemResizePending || claimCondition.Type == corev1.PersistentVolumeClaimResizing {
+			condition.Status = metav1.ConditionFalse
+			condition.Reason = string(claimCondition.Type)
+			condition.Message = claimCondition.Message
+			if condition.Message == "" {
+				condition.Message = fmt.Sprintf("The volume is being resized to %s", requested.String())
+			}
+			return condition
+		}
+	}
+
+	switch {
+	case requested.Cmp(storage) < 0 && !expansionAllowed:
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "ExpansionNotAllowed"
+		condition.Message = fmt.Sprintf("The StorageClass does not allow expanding the volume from %s to %s", requested.String(), storage.String())
+	case requested.Cmp(storage) < 0 || (pvc.Status.Phase == corev1.ClaimBound && capacity.Cmp(storage) < 0):
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "ResizePending"
+		condition.Message = fmt.Sprintf("Waiting for the volume to be resized to %s", storage.String())
+	}
+	return condition
+}
+
 func ReconcileSuccessCondition(status metav1.ConditionStatus, reason, message string) metav1.Condition {
 	return metav1.Condition{
 		Type:               ConditionReconciliationSuccess,
@@ -119,6 +223,71 @@ func IsJobCompleted(resources []runtime.Object) bool {
 	return jobCompleted
 }
 
+func IsJobFailed(resources []runtime.Object) bool {
+	return JobFailedCondition(resources) != nil
+}
+
+// JobFailedCondition returns the condition reporting the failure of the child job, or nil if it has not failed.
+func JobFailedCondition(resources []runtime.Object) *batchv1.JobCondition {
+	for _, resource := range resources {
+		if job, ok := resource.(*batchv1.Job); ok {
+			if job != nil {
+				for i := range job.Status.Conditions {
+					condition := &job.Status.Conditions[i]
+					if condition.Type == batchv1.JobFailed && condition.Status == corev1.ConditionTrue {
+						return condition
+					}
+				}
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func hasJob(resources []runtime.Object) bool {
+	for _, resource := range resources {
+		if job, ok := resource.(*batchv1.Job); ok && job != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// TerminationMessageTail returns the last lines of the termination messages of the
+// containers of the given pods that failed, oldest first.
+func TerminationMessageTail(pods []corev1.Pod) string {
+	terminations := []*corev1.ContainerStateTerminated{}
+	for _, pod := range pods {
+		for _, containerStatus := range pod.Status.ContainerStatuses {
+			for _, terminated := range []*corev1.ContainerStateTerminated{
+				containerStatus.LastTerminationState.Terminated,
+				containerStatus.State.Terminated,
+			} {
+				if terminated != nil && terminated.ExitCode != 0 && strings.TrimSpace(terminated.Message) != "" {
+					terminations = append(terminations, terminated)
+				}
+			}
+		}
+	}
+	sort.SliceStable(terminations, func(i, j int) bool {
+		return terminations[i].FinishedAt.Before(&terminations[j].FinishedAt)
+	})
+
+	lines := []string{}
+	for _, terminated := range terminations {
+		for _, line := range strings.Split(strings.TrimSpace(terminated.Message), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				lines = append(lines, line)
+			}
+		}
+	}
+	if len(lines) > maxTerminationMessageLines {
+		lines = lines[len(lines)-maxTerminationMessageLines:]
+	}
+	return strings.Join(lines, "\n")
+}
+
 func DoAllReplicasReady(resources []runtime.Object) bool {
 	allReplicasReady := false
 	for _, resource := range resources {
@@ -131,3 +300,65 @@ func DoAllReplicasReady(resources []runtime.Object) bool {
 	}
 	return allReplicasReady
 }
+
+// IsDeploymentRolledOut reports whether all replicas of the deployment run the latest pod template and are ready.
+func IsDeploymentRolledOut(resources []runtime.Object) bool {
+	rolledOut := false
+	for _, resource := range resources {
+		if deployment, ok := resource.(*appsv1.Deployment); ok {
+			if deployment != nil && deployment.Spec.Replicas != nil &&
+				deployment.Status.ObservedGeneration >= deployment.Generation &&
+				deployment.Status.UpdatedReplicas >= *deployment.Spec.Replicas &&
+				deployment.Status.ReadyReplicas >= *deployment.Spec.Replicas {
+				rolledOut = true
+			}
+			break
+		}
+	}
+	return rolledOut
+}
+
+// ServiceEndpoint returns the in-cluster address of the service, or an empty string if it does not exist yet.
+func ServiceEndpoint(resources []runtime.Object) string {
+	endpoint := ""
+	for _, resource := range resources {
+		if service, ok := resource.(*corev1.Service); ok {
+			if service != nil && len(service.Spec.Ports) > 0 {
+				endpoint = fmt.Sprintf("%s.%s.svc:%d", service.Name, service.Namespace, service.Spec.Ports[0].Port)
+			}
+			break
+		}
+	}
+	return endpoint
+}
+
+// CronJobLastSuccessfulTime returns the time the cron job last completed successfully.
+func CronJobLastSuccessfulTime(resources []runtime.Object) *metav1.Time {
+	var lastSuccessfulTime *metav1.Time
+	for _, resource := range resources {
+		if cronJob, ok := resource.(*batchv1.CronJob); ok {
+			if cronJob != nil {
+				lastSuccessfulTime = cronJob.Status.LastSuccessfulTime
+			}
+			break
+		}
+	}
+	return lastSuccessfulTime
+}
+
+// MapBuildReport is written by the map builder to its termination log once a build completes.
+type MapBuildReport struct {
+	// Checksums of the PBF extracts the map was built from, as <algorithm>:<value>.
+	Checksums []string `json:"checksums,omitempty"`
+
+	// TileExtractSize is the size of the tile extract in bytes.
+	TileExtractSize int64 `json:"tileExtractSize,omitempty"`
+}
+
+func ParseMapBuildReport(message string) (*MapBuildReport, error) {
+	report := &MapBuildReport{}
+	if err := json.Unmarshal([]byte(message), report); err != nil {
+		return nil, fmt.Errorf("failed to parse map build report: %v", err)
+	}
+	return report, nil
+}
@@ -1,11 +1,16 @@
 package status_test
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/itayankri/valhalla-operator/internal/status"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/utils/pointer"
@@ -245,5 +250,305 @@ var _ = Describe("Status", func() {
 				Expect(oldCondition.LastTransitionTime.Before(&condition.LastTransitionTime)).To(Equal(false))
 			})
 		})
+
+		Context("ConditionMapBuilt", func() {
+			It("Should return a new condition with ConditionTrue status if the map is built", func() {
+				condition := status.MapBuiltCondition([]runtime.Object{}, true, "", nil)
+				Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+				Expect(condition.Reason).To(Equal("MapBuilt"))
+			})
+
+			It("Should return a new condition with ConditionFalse status if the map builder is running", func() {
+				condition := status.MapBuiltCondition([]runtime.Object{&batchv1.Job{}}, false, "", nil)
+				Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+				Expect(condition.Reason).To(Equal("MapBuilding"))
+			})
+
+			It("Should return a new condition with the failure of the map builder if the child job has failed", func() {
+				childResources := []runtime.Object{
+					&batchv1.Job{
+						Status: batchv1.JobStatus{
+							Conditions: []batchv1.JobCondition{
+								{
+									Type:    batchv1.JobFailed,
+									Status:  corev1.ConditionTrue,
+									Reason:  "DeadlineExceeded",
+									Message: "Job was active longer than specified deadline",
+								},
+							},
+						},
+					},
+				}
+				condition := status.MapBuiltCondition(childResources, false, "", nil)
+				Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+				Expect(condition.Reason).To(Equal("MapBuildFailed"))
+				Expect(condition.Message).To(Equal("DeadlineExceeded: Job was active longer than specified deadline"))
+			})
+
+			It("Should keep the failure of the map builder once its pods are removed", func() {
+				childResources := []runtime.Object{
+					&batchv1.Job{
+						Status: batchv1.JobStatus{
+							Conditions: []batchv1.JobCondition{
+								{
+									Type:    batchv1.JobFailed,
+									Status:  corev1.ConditionTrue,
+									Reason:  "BackoffLimitExceeded",
+									Message: "Job has reached the specified backoff limit",
+								},
+							},
+						},
+					},
+				}
+				old := status.MapBuiltCondition(childResources, false, "ChecksumMismatch: sha256 checksum of a.pbf is 1, expected 2", nil)
+				condition := status.MapBuiltCondition(childResources, false, "", &old)
+				Expect(condition.Message).To(Equal(
+					"BackoffLimitExceeded: Job has reached the specified backoff limit\nChecksumMismatch: sha256 checksum of a.pbf is 1, expected 2"))
+			})
+		})
+	})
+
+	Context("ConditionVolumeResized", func() {
+		storage := resource.MustParse("20Gi")
+		pvc := func(requested, capacity string) *corev1.PersistentVolumeClaim {
+			return &corev1.PersistentVolumeClaim{
+				Spec: corev1.PersistentVolumeClaimSpec{
+					Resources: corev1.ResourceRequirements{
+						Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse(requested)},
+					},
+				},
+				Status: corev1.PersistentVolumeClaimStatus{
+					Phase:    corev1.ClaimBound,
+					Capacity: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse(capacity)},
+				},
+			}
+		}
+
+		It("Should return a condition with ConditionTrue status if the volume has the requested storage", func() {
+			condition := status.VolumeResizedCondition([]runtime.Object{pvc("20Gi", "20Gi")}, storage, true)
+			Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+		})
+
+		It("Should report that the StorageClass does not allow volume expansion", func() {
+			condition := status.VolumeResizedCondition([]runtime.Object{pvc("10Gi", "10Gi")}, storage, false)
+			Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+			Expect(condition.Reason).To(Equal("ExpansionNotAllowed"))
+		})
+
+		It("Should report a pending resize until the capacity of the volume grows", func() {
+			condition := status.VolumeResizedCondition([]runtime.Object{pvc("20Gi", "10Gi")}, storage, true)
+			Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+			Expect(condition.Reason).To(Equal("ResizePending"))
+		})
+
+		It("Should report the resize conditions of the claim", func() {
+			claim := pvc("20Gi", "10Gi")
+			claim.Status.Conditions = []corev1.PersistentVolumeClaimCondition{
+				{
+					Type:    corev1.PersistentVolumeClaimFileSystemResizePending,
+					Status:  corev1.ConditionTrue,
+					Message: "Waiting for user to (re-)start a pod to finish file system resize of volume on node.",
+				},
+			}
+			condition := status.VolumeResizedCondition([]runtime.Object{claim}, storage, true)
+			Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+			Expect(condition.Reason).To(Equal("FileSystemResizePending"))
+			Expect(condition.Message).To(Equal(claim.Status.Conditions[0].Message))
+		})
+	})
+
+	Context("Deployments", func() {
+		Context("IsDeploymentRolledOut", func() {
+			var deployment *appsv1.Deployment
+			BeforeEach(func() {
+				deployment = &appsv1.Deployment{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:       valhallaName,
+						Namespace:  "default",
+						Generation: 2,
+					},
+					Spec: appsv1.DeploymentSpec{
+						Replicas: pointer.Int32Ptr(2),
+					},
+					Status: appsv1.DeploymentStatus{
+						ObservedGeneration: 2,
+						UpdatedReplicas:    2,
+						ReadyReplicas:      2,
+					},
+				}
+			})
+
+			It("Should return 'true' if all replicas run the latest pod template and are ready", func() {
+				Expect(status.IsDeploymentRolledOut([]runtime.Object{deployment})).To(Equal(true))
+			})
+
+			It("Should return 'false' if not all replicas run the latest pod template", func() {
+				deployment.Status.UpdatedReplicas = 1
+				Expect(status.IsDeploymentRolledOut([]runtime.Object{deployment})).To(Equal(false))
+			})
+
+			It("Should return 'false' if the latest generation was not observed yet", func() {
+				deployment.Generation = 3
+				Expect(status.IsDeploymentRolledOut([]runtime.Object{deployment})).To(Equal(false))
+			})
+
+			It("Should return 'false' if child deployment is not present in child resources slice", func() {
+				Expect(status.IsDeploymentRolledOut([]runtime.Object{})).To(Equal(false))
+			})
+		})
+	})
+
+	Context("Jobs", func() {
+		Context("IsJobFailed", func() {
+			It("Should return 'true' if the child job has failed", func() {
+				childResources := []runtime.Object{
+					&batchv1.Job{
+						Status: batchv1.JobStatus{
+							Conditions: []batchv1.JobCondition{
+								{
+									Type:   batchv1.JobFailed,
+									Status: corev1.ConditionTrue,
+								},
+							},
+						},
+					},
+				}
+				Expect(status.IsJobFailed(childResources)).To(Equal(true))
+				Expect(status.IsJobCompleted(childResources)).To(Equal(false))
+			})
+
+			It("Should return 'false' if the child job has completed", func() {
+				childResources := []runtime.Object{
+					&batchv1.Job{
+						Status: batchv1.JobStatus{
+							Conditions: []batchv1.JobCondition{
+								{
+									Type:   batchv1.JobComplete,
+									Status: corev1.ConditionTrue,
+								},
+							},
+						},
+					},
+				}
+				Expect(status.IsJobFailed(childResources)).To(Equal(false))
+			})
+
+			It("Should return 'false' if child job is not present in child resources slice", func() {
+				childResources := []runtime.Object{}
+				Expect(status.IsJobFailed(childResources)).To(Equal(false))
+			})
+		})
+
+		Context("ParseMapBuildReport", func() {
+			It("Should parse the report of the map builder", func() {
+				report, err := status.ParseMapBuildReport(`{"checksums":["md5:3b5d5c3712955042212316173ccf37be"],"tileExtractSize":1048576}`)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(report.Checksums).To(Equal([]string{"md5:3b5d5c3712955042212316173ccf37be"}))
+				Expect(report.TileExtractSize).To(Equal(int64(1048576)))
+			})
+
+			It("Should fail on a message that is not a report", func() {
+				_, err := status.ParseMapBuildReport("Building tiles...")
+				Expect(err).To(HaveOccurred())
+			})
+		})
+
+		Context("TerminationMessageTail", func() {
+			terminated := func(message string, exitCode int32, finishedAt time.Time) *corev1.ContainerStateTerminated {
+				return &corev1.ContainerStateTerminated{
+					ExitCode:   exitCode,
+					Message:    message,
+					FinishedAt: metav1.Time{Time: finishedAt},
+				}
+			}
+
+			It("Should return the messages of failed containers, oldest first", func() {
+				now := time.Now()
+				pods := []corev1.Pod{
+					{
+						Status: corev1.PodStatus{
+							ContainerStatuses: []corev1.ContainerStatus{
+								{State: corev1.ContainerState{Terminated: terminated("checksum mismatch", 1, now)}},
+							},
+						},
+					},
+					{
+						Status: corev1.PodStatus{
+							ContainerStatuses: []corev1.ContainerStatus{
+								{
+									State:                corev1.ContainerState{Terminated: terminated("{\"checksums\":[]}", 0, now)},
+									LastTerminationState: corev1.ContainerState{Terminated: terminated("download failed\n", 1, now.Add(-time.Minute))},
+								},
+							},
+						},
+					},
+				}
+				Expect(status.TerminationMessageTail(pods)).To(Equal("download failed\nchecksum mismatch"))
+			})
+
+			It("Should only return the last lines of long messages", func() {
+				lines := []string{}
+				for i := 0; i < 20; i++ {
+					lines = append(lines, fmt.Sprintf("line %d", i))
+				}
+				pods := []corev1.Pod{
+					{
+						Status: corev1.PodStatus{
+							ContainerStatuses: []corev1.ContainerStatus{
+								{State: corev1.ContainerState{Terminated: terminated(strings.Join(lines, "\n"), 1, time.Now())}},
+							},
+						},
+					},
+				}
+				Expect(status.TerminationMessageTail(pods)).To(Equal(strings.Join(lines[10:], "\n")))
+			})
+		})
+	})
+
+	Context("CronJobs", func() {
+		Context("CronJobLastSuccessfulTime", func() {
+			It("Should return the last successful time of the child cron job", func() {
+				lastSuccessfulTime := metav1.NewTime(time.Date(2023, time.March, 1, 12, 0, 0, 0, time.UTC))
+				childResources := []runtime.Object{
+					&batchv1.CronJob{
+						Status: batchv1.CronJobStatus{
+							LastSuccessfulTime: &lastSuccessfulTime,
+						},
+					},
+				}
+				Expect(status.CronJobLastSuccessfulTime(childResources)).To(Equal(&lastSuccessfulTime))
+			})
+
+			It("Should return nil if the child cron job does not exist", func() {
+				var cronJob *batchv1.CronJob
+				childResources := []runtime.Object{cronJob}
+				Expect(status.CronJobLastSuccessfulTime(childResources)).To(BeNil())
+			})
+		})
+	})
+
+	Context("Services", func() {
+		Context("ServiceEndpoint", func() {
+			It("Should return the in-cluster address of the child service", func() {
+				childResources := []runtime.Object{
+					&corev1.Service{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      valhallaName,
+							Namespace: "default",
+						},
+						Spec: corev1.ServiceSpec{
+							Ports: []corev1.ServicePort{{Port: 80}},
+						},
+					},
+				}
+				Expect(status.ServiceEndpoint(childResources)).To(Equal("test.default.svc:80"))
+			})
+
+			It("Should return an empty string if the child service does not exist", func() {
+				var service *corev1.Service
+				childResources := []runtime.Object{service}
+				Expect(status.ServiceEndpoint(childResources)).To(BeEmpty())
+			})
+		})
 	})
 })